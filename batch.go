@@ -0,0 +1,212 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	flag "github.com/spf13/pflag"
+)
+
+// ApplyBatch updates several dynamic flags of the `flagSet` at once, with all-or-nothing semantics.
+//
+// All `values` are parsed and validated first, and if any of them is rejected, none of the flags change. Otherwise
+// the values are swapped together, and notifiers of all the flags are invoked only after the whole batch committed.
+// Readers that need a consistent view of several flags can use `ReadConsistent`.
+//
+// All flags of the batch must be dynamic. The new values are attributed to `SourceCommandLine`, use `ApplyBatchFrom`
+// to record a different provenance. Like setting them on the command line, this changes frozen flags too.
+func ApplyBatch(flagSet *flag.FlagSet, values map[string]string) error {
+	return ApplyBatchFrom(flagSet, values, nil)
+}
+
+// ApplyBatchFrom is like `ApplyBatch`, but records the `sources` of the new values, keyed by flag name.
+// Flags missing from `sources` are attributed to `SourceCommandLine`. Batches that change frozen flags from other
+// sources are rejected, see `Freeze`.
+func ApplyBatchFrom(flagSet *flag.FlagSet, values map[string]string, sources map[string]Source) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	return applyBatch(flagSet, names, func(batched batchValue, f *flag.Flag) (stagedUpdate, error) {
+		source, ok := sources[f.Name]
+		if !ok {
+			source = SourceCommandLine
+		}
+		if source != SourceCommandLine {
+			if err := CheckFlagNotFrozen(f); err != nil {
+				return nil, err
+			}
+		}
+		return batched.stage(values[f.Name], source)
+	})
+}
+
+// applyBatch stages updates of the flags `names` with the `stage` function, and if all of them succeed, commits them.
+func applyBatch(flagSet *flag.FlagSet, names []string, stage func(batched batchValue, f *flag.Flag) (stagedUpdate, error)) error {
+	// Sorting gives a stable locking order, so that concurrent batches can't deadlock.
+	sort.Strings(names)
+
+	flags := make([]*flag.Flag, 0, len(names))
+	updates := make([]stagedUpdate, 0, len(names))
+	errorStrings := []string{}
+	for _, name := range names {
+		f := flagSet.Lookup(name)
+		if f == nil {
+			errorStrings = append(errorStrings, fmt.Sprintf("flag=%v was not found", name))
+			continue
+		}
+		batched, ok := f.Value.(batchValue)
+		if !ok || !IsFlagDynamic(f) {
+			errorStrings = append(errorStrings, fmt.Sprintf("flag=%v is not a dynamic flag", name))
+			continue
+		}
+		update, err := stage(batched, f)
+		if err != nil {
+			errorStrings = append(errorStrings, fmt.Sprintf("flag=%v: %v", name, err))
+			continue
+		}
+		flags = append(flags, f)
+		updates = append(updates, update)
+	}
+	if len(errorStrings) > 0 {
+		return fmt.Errorf("flagz: batch rejected with %d errors: \n  %v", len(errorStrings), strings.Join(errorStrings, "\n  "))
+	}
+
+	state := flagSetStateOf(flagSet)
+	state.commitMu.Lock()
+	defer state.commitMu.Unlock()
+	proposed := make(map[string]interface{}, len(updates))
+	for i, u := range updates {
+		proposed[flags[i].Name] = u.value()
+	}
+	if err := state.validate(flagSet, proposed); err != nil {
+		for _, u := range updates {
+			u.reject(err)
+		}
+		return fmt.Errorf("flagz: batch rejected: %v", err)
+	}
+	if err := commitBatch(state, flags, updates); err != nil {
+		return err
+	}
+	for _, f := range flags {
+		markFlagSet(flagSet, f)
+	}
+	return nil
+}
+
+// commitBatch swaps in all the staged `updates` of the `flags`, or none of them.
+//
+// Readers are only held off by `mu` while the values are swapped, so that commit hooks, which run afterwards, can
+// read the `FlagSet` too. If a commit hook vetoes its value, all the values are swapped back together.
+func commitBatch(state *flagSetState, flags []*flag.Flag, updates []stagedUpdate) error {
+	for _, u := range updates {
+		u.lock()
+		defer u.unlock()
+	}
+	state.mu.Lock()
+	for _, u := range updates {
+		u.swap()
+	}
+	state.mu.Unlock()
+	restore := func() {
+		state.mu.Lock()
+		defer state.mu.Unlock()
+		for _, u := range updates {
+			u.restore()
+		}
+	}
+	for i, u := range updates {
+		if err := u.commit(restore); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				updates[j].undo()
+			}
+			return fmt.Errorf("flagz: batch rolled back, flag=%v: %v", flags[i].Name, err)
+		}
+	}
+	for _, u := range updates {
+		u.finish()
+	}
+	return nil
+}
+
+// ReadConsistent runs `fn` so that it doesn't observe a half-applied `ApplyBatch` on the `flagSet`.
+// Batches that are started while `fn` runs wait for it to return, so `fn` should be short. It may observe a batch
+// that a commit hook vetoes afterwards, like `Get` may observe a value that is vetoed. `fn` must not update flags of
+// the `flagSet`.
+func ReadConsistent(flagSet *flag.FlagSet, fn func()) {
+	state := flagSetStateOf(flagSet)
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	fn()
+}
+
+// flagSetState holds the state flagz keeps for a whole `FlagSet`, rather than for its individual flags.
+type flagSetState struct {
+	// commitMu serializes batches and updates checked by flag set validators, from validation until they're committed.
+	commitMu sync.Mutex
+	// mu is held for writing only while the values of a batch are swapped, and for reading by consistent readers.
+	mu      sync.RWMutex
+	hooksMu sync.Mutex
+	// pflagMu serializes calls to `FlagSet.Set` made by flagz, since `pflag` updates the `FlagSet` without locking.
+	pflagMu    sync.Mutex
+	validators []*flagSetValidator
+	// version is increased with every committed update of a dynamic flag of the `FlagSet`.
+	version atomic.Uint64
+}
+
+// flagSetStates maps each `FlagSet` that flagz was used with to its `flagSetState`. Entries keep their `FlagSet`
+// reachable until `ReleaseFlagSet` removes them, since looking the state up through the flags themselves would need
+// `FlagSet.VisitAll`, which isn't safe for concurrent use.
+var flagSetStates sync.Map
+
+// ReleaseFlagSet drops the state flagz keeps for the `flagSet`, such as its flag set validators and the version of
+// its values, so that the `FlagSet` can be garbage collected. Programs that create short-lived flag sets, e.g. in
+// tests, should call it once they're done with a `FlagSet`, which must not be used with flagz afterwards.
+func ReleaseFlagSet(flagSet *flag.FlagSet) {
+	flagSetStates.Delete(flagSet)
+}
+
+func flagSetStateOf(flagSet *flag.FlagSet) *flagSetState {
+	if state, ok := flagSetStates.Load(flagSet); ok {
+		return state.(*flagSetState)
+	}
+	state, _ := flagSetStates.LoadOrStore(flagSet, &flagSetState{})
+	return state.(*flagSetState)
+}
+
+type batchValue interface {
+	stage(input string, source Source) (stagedUpdate, error)
+	// stageAny is like stage, but takes a value of the flag's type, e.g. one read from a `FlagSetSnapshot`.
+	stageAny(value interface{}, source Source) (stagedUpdate, error)
+}
+
+// stagedUpdate is a parsed and validated value of a flag, waiting to be swapped in.
+// Once all updates of a batch are staged, the steps are run in order: lock, swap, commit, and then either restore and
+// undo, or finish, followed by unlock.
+type stagedUpdate interface {
+	// value returns the new value, as seen by flag set validators.
+	value() interface{}
+	// reject records that the update was rejected as a whole, e.g. by a flag set validator.
+	reject(err error)
+	// clearOverride makes the update replace the value of an active temporary override and drop it, instead of only
+	// replacing the value the override reverts to.
+	clearOverride()
+	lock()
+	unlock()
+	// swap stores the new value.
+	swap()
+	// commit runs commit hooks. If one of them fails, the hooks that ran are undone after calling `restore`.
+	commit(restore func()) error
+	// restore reverts the swap.
+	restore()
+	// undo reverts a successful commit, invoking commit hooks with old and new values swapped.
+	undo()
+	// finish records the update and invokes listeners and notifiers.
+	finish()
+}
@@ -0,0 +1,164 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyBatch_AppliesAllValues(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	rate := DynInt64(set, "rate", 10, "Use it or lose it")
+	burst := DynInt64(set, "burst", 20, "Use it or lose it")
+	observed := make(chan int64, 1)
+	rate.WithNotifier(func(oldValue int64, newValue int64) {
+		observed <- burst.Get()
+	})
+
+	err := ApplyBatchFrom(set, map[string]string{"rate": "100", "burst": "200"}, map[string]Source{"rate": FileSource("/etc/flagz/rate")})
+	require.NoError(t, err, "valid batch must succeed")
+	assert.Equal(t, int64(100), rate.Get())
+	assert.Equal(t, int64(200), burst.Get())
+	assert.True(t, set.Lookup("rate").Changed, "batched flags must be marked as changed")
+	assert.Equal(t, FileSource("/etc/flagz/rate"), FlagSource(set.Lookup("rate")))
+	assert.Equal(t, SourceCommandLine, FlagSource(set.Lookup("burst")), "flags without a source must come from the command line")
+	select {
+	case v := <-observed:
+		assert.Equal(t, int64(200), v, "notifiers must run after the whole batch committed")
+	case <-time.After(5 * time.Millisecond):
+		assert.Fail(t, "notifier must be invoked")
+	}
+}
+
+func TestApplyBatch_RejectsAllOnValidationFailure(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	rate := DynInt64(set, "rate", 10, "Use it or lose it")
+	burst := DynInt64(set, "burst", 20, "Use it or lose it").WithValidator(ValidateDynInt64Range(0, 100))
+	rate.WithNotifier(func(oldValue int64, newValue int64) {
+		assert.Fail(t, "notifiers must not run for rejected batches")
+	})
+
+	assert.Error(t, ApplyBatch(set, map[string]string{"rate": "100", "burst": "200"}), "batch with an invalid value must fail")
+	assert.Error(t, ApplyBatch(set, map[string]string{"rate": "100", "burst": "notanint"}), "batch with a bad value must fail")
+	assert.Error(t, ApplyBatch(set, map[string]string{"rate": "100", "unknown_flag": "1"}), "batch with an unknown flag must fail")
+	assert.Equal(t, int64(10), rate.Get(), "no value of a rejected batch may be applied")
+	assert.Equal(t, int64(20), burst.Get())
+	assert.False(t, set.Lookup("rate").Changed, "flags of rejected batches must not be marked as changed")
+	time.Sleep(5 * time.Millisecond)
+}
+
+func TestApplyBatch_RejectsStaticFlags(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	rate := DynInt64(set, "rate", 10, "Use it or lose it")
+	set.Int64("some_static_int", 1, "Use it or lose it")
+
+	assert.Error(t, ApplyBatch(set, map[string]string{"rate": "100", "some_static_int": "2"}), "batch with a static flag must fail")
+	assert.Equal(t, int64(10), rate.Get())
+}
+
+func TestApplyBatchFrom_RefusesFrozenFlags(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	rate := DynInt64(set, "rate", 10, "Use it or lose it")
+	burst := DynInt64(set, "burst", 20, "Use it or lose it")
+	require.NoError(t, Freeze(set, "rate", "release freeze"))
+
+	values := map[string]string{"rate": "100", "burst": "200"}
+	err := ApplyBatchFrom(set, values, map[string]Source{"rate": "test", "burst": "test"})
+	require.Error(t, err, "batch changing a frozen flag must fail")
+	assert.Contains(t, err.Error(), "release freeze")
+	assert.Equal(t, int64(10), rate.Get())
+	assert.Equal(t, int64(20), burst.Get(), "no flag of the batch must change")
+
+	require.NoError(t, ApplyBatch(set, values), "command line batches must still change frozen flags")
+	assert.Equal(t, int64(100), rate.Get())
+}
+
+func TestApplyBatch_RollsBackOnCommitHookFailure(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	applied := map[string]int64{}
+	burst := DynInt64(set, "burst", 20, "Use it or lose it")
+	burst.WithCommitHook(func(oldValue int64, newValue int64) error {
+		applied["burst"] = newValue
+		return nil
+	})
+	rate := DynInt64(set, "rate", 10, "Use it or lose it")
+	rate.WithCommitHook(func(oldValue int64, newValue int64) error {
+		return fmt.Errorf("can't apply rate")
+	})
+
+	err := ApplyBatch(set, map[string]string{"rate": "100", "burst": "200"})
+	require.Error(t, err, "batch with a vetoed value must fail")
+	assert.Contains(t, err.Error(), "can't apply rate")
+	assert.Equal(t, int64(10), rate.Get())
+	assert.Equal(t, int64(20), burst.Get(), "flags committed earlier in the batch must be rolled back")
+	assert.Equal(t, int64(20), applied["burst"], "commit hooks of rolled back flags must be invoked to undo their changes")
+}
+
+func TestApplyBatch_CommitHooksCanReadTheFlagSet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	type config struct {
+		Rate int64 `flagz:"dynamic"`
+	}
+	structFlags, err := RegisterStruct(set, "", &config{Rate: 10})
+	require.NoError(t, err)
+	burst := DynInt64(set, "burst", 20, "Use it or lose it")
+	var observed []string
+	burst.WithCommitHook(func(oldValue int64, newValue int64) error {
+		observed = append(observed, Snapshot(set).String("rate"))
+		ReadConsistent(set, func() {
+			observed = append(observed, fmt.Sprint(structFlags.Get().Rate))
+		})
+		return nil
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- ApplyBatch(set, map[string]string{"rate": "100", "burst": "200"})
+	}()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "commit hooks reading the flag set must not deadlock")
+	}
+	assert.Equal(t, []string{"100", "100"}, observed, "commit hooks must see the whole batch")
+}
+
+func TestReadConsistent_NeverObservesHalfAppliedBatches(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	rate := DynInt64(set, "rate", 0, "Use it or lose it")
+	burst := DynInt64(set, "burst", 0, "Use it or lose it")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 100; i++ {
+			ApplyBatch(set, map[string]string{"rate": fmt.Sprintf("%d", i), "burst": fmt.Sprintf("%d", i)})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		ReadConsistent(set, func() {
+			assert.Equal(t, rate.Get(), burst.Get(), "batches must be observed as a whole")
+		})
+	}
+	<-done
+}
+
+func TestReleaseFlagSet_DropsItsState(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynInt64(set, "rate", 10, "Use it or lose it")
+	require.NoError(t, ApplyBatch(set, map[string]string{"rate": "11"}))
+	_, ok := flagSetStates.Load(set)
+	require.True(t, ok, "flagz must keep the state of a FlagSet it was used with")
+
+	ReleaseFlagSet(set)
+	_, ok = flagSetStates.Load(set)
+	assert.False(t, ok, "released FlagSets must not be kept reachable")
+}
@@ -0,0 +1,78 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// CanonicalStringer is implemented by flag values that have a canonical string representation: equal values always
+// have the same representation, regardless of how they were set, e.g. the order of items of a set or of keys of a
+// JSON object. `ChecksumFlagSet` prefers it over `String`, so that processes with equal flags have equal checksums.
+//
+// All dynamic flags of this package implement it. Custom `Codec`s can provide the canonical representation with a
+// `Canonical(value T) string` method, otherwise their `Format` is assumed to be canonical.
+type CanonicalStringer interface {
+	CanonicalString() string
+}
+
+// canonicalCodec is implemented by codecs whose `Format` isn't canonical.
+type canonicalCodec[T any] interface {
+	Canonical(value T) string
+}
+
+// CanonicalString returns the canonical representation of the current value, see `CanonicalStringer`.
+func (d *DynValue[T]) CanonicalString() string {
+	if c, ok := d.codec.(canonicalCodec[T]); ok {
+		return c.Canonical(d.Get())
+	}
+	return d.codec.Format(d.Get())
+}
+
+// CanonicalJSON returns the canonical form of a JSON document: compact, with keys of objects sorted and numbers kept
+// as they were written. It is meant for the `Canonical` method of codecs of JSON-encoded values.
+func CanonicalJSON(input []byte) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(input))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+	out, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func canonicalJSONOrErr(formatted string) string {
+	out, err := CanonicalJSON([]byte(formatted))
+	if err != nil {
+		return "ERR"
+	}
+	return out
+}
+
+// canonicalString returns the canonical representation of the flag's value if it has one, and `String` otherwise.
+func canonicalString(f *flag.Flag) string {
+	if c, ok := f.Value.(CanonicalStringer); ok {
+		return c.CanonicalString()
+	}
+	return f.Value.String()
+}
+
+// formatCSV formats items as a CSV record, the way slice flags are parsed, so that items containing commas or spaces
+// are unambiguous.
+func formatCSV(items []string) string {
+	out := &strings.Builder{}
+	w := csv.NewWriter(out)
+	w.Write(items)
+	w.Flush()
+	return strings.TrimSuffix(out.String(), "\n")
+}
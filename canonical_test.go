@@ -0,0 +1,107 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type canonicalTestJSON struct {
+	SomeString string `json:"some_string"`
+	SomeInt    int32  `json:"some_int"`
+	// SomeRaw keeps the input as it was, including the order of keys.
+	SomeRaw json.RawMessage `json:"some_raw,omitempty"`
+}
+
+// newCanonicalTestFlagSet creates a flag set with a flag of each type, all set from the given inputs.
+func newCanonicalTestFlagSet(t *testing.T, inputs map[string]string) *flag.FlagSet {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	flagz.DynStringSet(set, "some_stringset", []string{}, "Use it or lose it")
+	flagz.DynStringSlice(set, "some_stringslice", []string{}, "Use it or lose it")
+	flagz.DynJSON(set, "some_json", &canonicalTestJSON{}, "Use it or lose it")
+	flagz.DynJSONOf(set, "some_json_of", &canonicalTestJSON{}, "Use it or lose it")
+	flagz.DynFloat64(set, "some_float64", 0, "Use it or lose it")
+	flagz.DynDuration(set, "some_duration", 0, "Use it or lose it")
+	flagz.DynRollout(set, "some_rollout", &flagz.Rollout{}, "Use it or lose it")
+	set.StringSlice("some_static_stringslice", []string{}, "Use it or lose it")
+	for name, input := range inputs {
+		require.NoError(t, set.Set(name, input), "setting %v must not fail", name)
+	}
+	return set
+}
+
+func TestChecksumFlagSet_EqualValuesHashEqually(t *testing.T) {
+	first := newCanonicalTestFlagSet(t, map[string]string{
+		"some_stringset":          "a,b,c,d,e,f,g,h",
+		"some_stringslice":        "a,b",
+		"some_json":               `{"some_raw": {"a": 1, "b": {"c": [1, 2], "d": "e"}}}`,
+		"some_json_of":            `{"some_int": 1, "some_string": "foo"}`,
+		"some_float64":            "1.50",
+		"some_duration":           "60s",
+		"some_rollout":            `{"percentage": 5, "allow": ["qa"]}`,
+		"some_static_stringslice": "a,b",
+	})
+	firstChecksum := flagz.ChecksumFlagSet(first, nil)
+	for i := 0; i < 20; i++ {
+		other := newCanonicalTestFlagSet(t, map[string]string{
+			"some_stringset":          "h,g,f,e,d,c,b,a",
+			"some_stringslice":        `"a",b`,
+			"some_json":               `{"some_raw": {"b": {"d": "e", "c": [1, 2]}, "a": 1}}`,
+			"some_json_of":            `{"some_string": "foo", "some_int": 1}`,
+			"some_float64":            "1.5",
+			"some_duration":           "1m",
+			"some_rollout":            `{"allow": ["qa"], "percentage": 5.0}`,
+			"some_static_stringslice": "a,b",
+		})
+		require.Equal(t, firstChecksum, flagz.ChecksumFlagSet(other, nil), "equal values must always hash equally")
+	}
+}
+
+func TestCanonicalString_DistinguishesDifferentValues(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	spaced := flagz.DynStringSlice(set, "some_stringslice_1", []string{"a b"}, "Use it or lose it")
+	split := flagz.DynStringSlice(set, "some_stringslice_2", []string{"a", "b"}, "Use it or lose it")
+	assert.Equal(t, spaced.String(), split.String(), "String of slices is ambiguous")
+	assert.NotEqual(t, spaced.CanonicalString(), split.CanonicalString(), "CanonicalString of slices must not be ambiguous")
+	assert.Equal(t, "a,b", split.CanonicalString())
+
+	zero := flagz.DynFloat64(set, "some_float64_1", 0, "Use it or lose it")
+	require.NoError(t, set.Set("some_float64_1", "-0"))
+	assert.Equal(t, "0", zero.CanonicalString())
+
+	setVal := flagz.DynStringSet(set, "some_stringset_1", []string{"b", "a"}, "Use it or lose it")
+	assert.Equal(t, "[a b]", setVal.String(), "String of sets must be sorted")
+	assert.Equal(t, "a,b", setVal.CanonicalString())
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	out, err := flagz.CanonicalJSON([]byte(`{ "b": [1, {"d": 2, "c": 12345678901234567890}], "a": null }`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":null,"b":[1,{"c":12345678901234567890,"d":2}]}`, out)
+
+	_, err = flagz.CanonicalJSON([]byte(`{"a":`))
+	assert.Error(t, err)
+}
+
+func TestCanonicalString_ImplementedByAllTypes(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	for _, value := range []flag.Value{
+		flagz.DynInt64(set, "some_int64", 1, "Use it or lose it"),
+		flagz.DynString(set, "some_string", "foo", "Use it or lose it"),
+		flagz.DynSecret(set, "some_secret", "foo", "Use it or lose it"),
+		flagz.DynDuration(set, "some_duration", time.Second, "Use it or lose it"),
+		flagz.Dyn[int](set, "some_dyn", 1, flagz.NewCodec[int]("int", nil, func(v int) string { return "1" }), "Use it or lose it"),
+	} {
+		canonical, ok := value.(flagz.CanonicalStringer)
+		require.True(t, ok, "%v must implement CanonicalStringer", value.Type())
+		assert.Equal(t, value.String(), canonical.CanonicalString(), "canonical %v must default to its String", value.Type())
+	}
+}
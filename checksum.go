@@ -4,12 +4,35 @@
 package flagz
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"hash/fnv"
+	"sync/atomic"
 
 	"github.com/spf13/pflag"
 )
 
+// checksumSecretKey keys the hash of secret flag values, see `SetChecksumSecretKey`. Nil until a key is set.
+var checksumSecretKey atomic.Pointer[[]byte]
+
+// SetChecksumSecretKey sets the key of the hash that `ChecksumFlagSet` applies to values of secret flags.
+//
+// By default values of secret flags are left out of the checksum, so that it can't be used to guess secrets, and
+// changes of secrets don't change it. Processes that share a key have checksums that cover secrets too. An empty key
+// restores the default.
+func SetChecksumSecretKey(key []byte) {
+	if len(key) == 0 {
+		checksumSecretKey.Store(nil)
+		return
+	}
+	key = append([]byte(nil), key...)
+	checksumSecretKey.Store(&key)
+}
+
 // ChecksumFlagSet will generate a FNV of the *set* values in a FlagSet.
+// Values are hashed in their canonical representation if they have one, see `CanonicalStringer`.
+// Values of secret flags, see `MarkFlagSecret`, only contribute their HMAC-SHA256 keyed with `SetChecksumSecretKey`,
+// and nothing if no key was set.
 func ChecksumFlagSet(flagSet *pflag.FlagSet, flagFilter func(flag *pflag.Flag) bool) []byte {
 	h := fnv.New32a()
 	flagSet.VisitAll(func(flag *pflag.Flag) {
@@ -17,7 +40,17 @@ func ChecksumFlagSet(flagSet *pflag.FlagSet, flagFilter func(flag *pflag.Flag) b
 			return
 		}
 		h.Write([]byte(flag.Name))
-		h.Write([]byte(flag.Value.String()))
+		if IsFlagSecret(flag) {
+			key := checksumSecretKey.Load()
+			if key == nil {
+				return
+			}
+			mac := hmac.New(sha256.New, *key)
+			mac.Write([]byte(canonicalString(flag)))
+			h.Write(mac.Sum(nil))
+			return
+		}
+		h.Write([]byte(canonicalString(flag)))
 	})
 	return h.Sum(nil)
 }
@@ -63,3 +63,38 @@ func TestChecksumFlagSet_Filters(t *testing.T) {
 	t.Logf("post set2 checksum: %x", postSet2Checksum)
 	assert.NotEqual(t, postSet1Checksum, postSet2Checksum, "checksum change when some_duration_1 changes")
 }
+
+func TestChecksumFlagSet_SecretsAreLeftOutWithoutKey(t *testing.T) {
+	flagz.SetChecksumSecretKey(nil)
+	checksum := func(secret string) []byte {
+		set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+		flagz.DynSecret(set, "some_secret_1", "", "Use it or lose it")
+		require.NoError(t, set.Set("some_secret_1", secret))
+		return flagz.ChecksumFlagSet(set, nil)
+	}
+	assert.Equal(t, checksum("hunter2"), checksum("hunter2"), "flag sets with the same secret must have the same checksum")
+	assert.Equal(t, checksum("hunter2"), checksum("hunter3"), "secret values must be left out without a key")
+}
+
+func TestChecksumFlagSet_SecretsAreKeyed(t *testing.T) {
+	defer flagz.SetChecksumSecretKey(nil)
+	flagz.SetChecksumSecretKey([]byte("key1"))
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	flagz.DynSecret(set, "some_secret_1", "", "Use it or lose it")
+	require.NoError(t, set.Set("some_secret_1", "hunter2"))
+
+	plainSet := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	flagz.DynString(plainSet, "some_secret_1", "", "Use it or lose it")
+	require.NoError(t, plainSet.Set("some_secret_1", "hunter2"))
+	assert.NotEqual(t, flagz.ChecksumFlagSet(plainSet, nil), flagz.ChecksumFlagSet(set, nil), "secret values must not be hashed plainly")
+
+	key1Checksum := flagz.ChecksumFlagSet(set, nil)
+	flagz.SetChecksumSecretKey([]byte("key2"))
+	key2Checksum := flagz.ChecksumFlagSet(set, nil)
+	assert.NotEqual(t, key1Checksum, key2Checksum, "checksum of secrets must depend on the key")
+	flagz.SetChecksumSecretKey([]byte("key1"))
+	assert.Equal(t, key1Checksum, flagz.ChecksumFlagSet(set, nil), "checksum with the same key must be stable")
+
+	require.NoError(t, set.Set("some_secret_1", "hunter3"))
+	assert.NotEqual(t, key1Checksum, flagz.ChecksumFlagSet(set, nil), "checksum must change with the secret value")
+}
@@ -4,23 +4,128 @@
 package flagz
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+
 	flag "github.com/spf13/pflag"
 )
 
 const (
 	dynamicMarker = "__is_dynamic"
+	frozenMarker  = "__frozen"
 )
 
+// ErrFlagFrozen is returned by updaters when they refuse to change a frozen flag, see `Freeze`.
+var ErrFlagFrozen = errors.New("flag is frozen")
+
+// annotationsMu guards annotations of flags, which, unlike in plain `pflag`, can change at runtime.
+var annotationsMu sync.RWMutex
+
 // MarkFlagDynamic marks the flag as Dynamic and changeable at runtime.
 func MarkFlagDynamic(f *flag.Flag) {
-	if f.Annotations == nil {
-		f.Annotations = make(map[string][]string)
-	}
-	f.Annotations[dynamicMarker] = []string{}
+	setAnnotation(f, dynamicMarker, []string{})
 }
 
 // IsFlagDynamic returns whether the given Flag has been created in a Dynamic mode.
 func IsFlagDynamic(f *flag.Flag) bool {
-	_, ok := f.Annotations[dynamicMarker]
+	_, ok := getAnnotation(f, dynamicMarker)
 	return ok
 }
+
+// Freeze pins the dynamic flag `name` of the `flagSet`, so that updaters, such as the etcd `Watcher` and the
+// ConfigMap `Updater`, refuse to change it until `Unfreeze` is called. The `reason` is logged with each refused
+// change and shown on the `/debug/flagz` page.
+func Freeze(flagSet *flag.FlagSet, name string, reason string) error {
+	f := flagSet.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("flag=%v was not found", name)
+	}
+	if !IsFlagDynamic(f) {
+		return fmt.Errorf("flag=%v is not a dynamic flag", name)
+	}
+	setAnnotation(f, frozenMarker, []string{reason})
+	return nil
+}
+
+// Unfreeze allows updaters to change a flag pinned with `Freeze` again.
+func Unfreeze(flagSet *flag.FlagSet, name string) error {
+	f := flagSet.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("flag=%v was not found", name)
+	}
+	setAnnotation(f, frozenMarker, nil)
+	return nil
+}
+
+// IsFlagFrozen returns whether the given Flag is frozen, and the reason it was frozen for, see `Freeze`.
+func IsFlagFrozen(f *flag.Flag) (reason string, frozen bool) {
+	values, ok := getAnnotation(f, frozenMarker)
+	if !ok || len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+// CheckFlagNotFrozen returns an error wrapping `ErrFlagFrozen` and naming the freeze reason if the flag is frozen.
+// It is meant for updaters, which should refuse to change frozen flags.
+func CheckFlagNotFrozen(f *flag.Flag) error {
+	if reason, frozen := IsFlagFrozen(f); frozen {
+		return fmt.Errorf("%w: %v", ErrFlagFrozen, reason)
+	}
+	return nil
+}
+
+func getAnnotation(f *flag.Flag, key string) ([]string, bool) {
+	annotationsMu.RLock()
+	defer annotationsMu.RUnlock()
+	values, ok := f.Annotations[key]
+	return values, ok
+}
+
+// setAnnotation sets the annotation `key` of the flag, or removes it if `values` is nil.
+// The annotations map is copied on write, so that code reading it without `annotationsMu`, e.g. `pflag` itself, never
+// sees a map that is being modified.
+func setAnnotation(f *flag.Flag, key string, values []string) {
+	annotationsMu.Lock()
+	defer annotationsMu.Unlock()
+	annotations := make(map[string][]string, len(f.Annotations)+1)
+	for k, v := range f.Annotations {
+		annotations[k] = v
+	}
+	if values == nil {
+		delete(annotations, key)
+	} else {
+		annotations[key] = values
+	}
+	f.Annotations = annotations
+}
+
+// ResetFlag reverts a dynamic flag of the `flagSet` to its default value and clears its `Changed` state, after which
+// `FlagSource` reports it as coming from `SourceDefault`.
+//
+// The default value is subject to the flag's validators and notifiers. This is used by updaters to revert flags whose
+// values were deleted from their source. `pflag` offers no way to forget that the flag was set, so it is still
+// counted by `FlagSet.NFlag` and visited by `FlagSet.Visit`.
+func ResetFlag(flagSet *flag.FlagSet, name string) error {
+	f := flagSet.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("flag=%v was not found", name)
+	}
+	resetter, ok := f.Value.(resettableValue)
+	if !ok || !IsFlagDynamic(f) {
+		return fmt.Errorf("flag=%v is not a resettable dynamic flag", name)
+	}
+	if err := resetter.Reset(); err != nil {
+		return err
+	}
+	state := flagSetStateOf(flagSet)
+	state.pflagMu.Lock()
+	f.Changed = false
+	state.pflagMu.Unlock()
+	return nil
+}
+
+type resettableValue interface {
+	Reset() error
+}
@@ -0,0 +1,37 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"errors"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeze_MarksFlagAsFrozen(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynInt64(set, "some_int_1", 1, "Use it or lose it")
+	set.Int64("some_static_int", 1, "Use it or lose it")
+	f := set.Lookup("some_int_1")
+
+	require.NoError(t, Freeze(set, "some_int_1", "release freeze"))
+	reason, frozen := IsFlagFrozen(f)
+	assert.True(t, frozen)
+	assert.Equal(t, "release freeze", reason)
+	assert.True(t, IsFlagDynamic(f), "freezing must keep the flag dynamic")
+	err := CheckFlagNotFrozen(f)
+	assert.True(t, errors.Is(err, ErrFlagFrozen), "updaters must be able to tell frozen flags")
+	assert.Contains(t, err.Error(), "release freeze", "error must name the freeze reason")
+
+	require.NoError(t, Unfreeze(set, "some_int_1"))
+	_, frozen = IsFlagFrozen(f)
+	assert.False(t, frozen)
+	assert.NoError(t, CheckFlagNotFrozen(f))
+
+	assert.Error(t, Freeze(set, "some_static_int", "static"), "static flags can't be frozen")
+	assert.Error(t, Freeze(set, "unknown_flag", "unknown"), "unknown flags can't be frozen")
+}
@@ -8,6 +8,7 @@ package configmap
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
 	"strings"
 
@@ -40,7 +41,10 @@ type Updater struct {
 	flagSet *flag.FlagSet
 	logger  loggerCompatible
 	done    chan bool
-
+	// fileFlags holds names of dynamic flags that were set from files, so they can be reset if their files disappear.
+	fileFlags map[string]struct{}
+	// secret marks all flags read by this updater with `flagz.MarkFlagSecret`.
+	secret bool
 }
 
 func New(flagSet *flag.FlagSet, dirPath string, logger loggerCompatible) (*Updater, error) {
@@ -53,9 +57,22 @@ func New(flagSet *flag.FlagSet, dirPath string, logger loggerCompatible) (*Updat
 		logger:  logger,
 		dirPath: dirPath,
 		watcher: watcher,
+		fileFlags: make(map[string]struct{}),
 	}, nil
 }
 
+// NewForSecret creates an Updater of flags from a mounted Kubernetes Secret, rather than a ConfigMap.
+// Both are mounted the same way, but all flags read from a Secret are marked with `flagz.MarkFlagSecret`, so that their
+// values are redacted from the `/debug/flagz` pages, logs and flag history.
+func NewForSecret(flagSet *flag.FlagSet, dirPath string, logger loggerCompatible) (*Updater, error) {
+	u, err := New(flagSet, dirPath, logger)
+	if err != nil {
+		return nil, err
+	}
+	u.secret = true
+	return u, nil
+}
+
 func (u *Updater) Initialize() error {
 	if u.started {
 		return fmt.Errorf("flagz: already initialized updater.")
@@ -92,18 +109,59 @@ func (u *Updater) readAll(dynamicOnly bool) error {
 		return fmt.Errorf("flagz: updater initialization: %v", err)
 	}
 	errorStrings := []string{}
+	seenFlags := make(map[string]struct{})
+	// Dynamic flags are applied as one batch, so that related flags of a ConfigMap change together.
+	batchValues := make(map[string]string)
+	batchSources := make(map[string]flagz.Source)
 	for _, f := range files {
 		if strings.HasPrefix(path.Base(f.Name()), "..") {
 			// skip random ConfigMap internals
 			continue
 		}
 		fullPath := path.Join(u.dirPath, f.Name())
-		if err := u.readFlagFile(fullPath, dynamicOnly); err != nil {
-			if err == errFlagNotDynamic && dynamicOnly {
-				// ignore
-			} else {
-				errorStrings = append(errorStrings, fmt.Sprintf("flag %v: %v", f.Name(), err.Error()))
+		flag := u.flagSet.Lookup(f.Name())
+		if flag == nil || !flagz.IsFlagDynamic(flag) || flagz.CheckFlagNotFrozen(flag) != nil {
+			if err := u.readFlagFile(fullPath, dynamicOnly); err != nil {
+				if err == errFlagNotDynamic && dynamicOnly {
+					// ignore
+				} else if os.IsNotExist(err) {
+					// dangling symlink of a key removed from the ConfigMap, treat as deleted
+					continue
+				} else {
+					errorStrings = append(errorStrings, fmt.Sprintf("flag %v: %v", f.Name(), err.Error()))
+				}
 			}
+			seenFlags[f.Name()] = struct{}{}
+			continue
+		}
+		content, err := ioutil.ReadFile(fullPath)
+		if os.IsNotExist(err) {
+			// dangling symlink of a key removed from the ConfigMap, treat as deleted
+			continue
+		} else if err != nil {
+			errorStrings = append(errorStrings, fmt.Sprintf("flag %v: %v", f.Name(), err.Error()))
+		} else {
+			u.markSecret(flag)
+			batchValues[f.Name()] = string(content)
+			batchSources[f.Name()] = flagz.FileSource(fullPath)
+		}
+		seenFlags[f.Name()] = struct{}{}
+	}
+	if err := flagz.ApplyBatchFrom(u.flagSet, batchValues, batchSources); err != nil {
+		errorStrings = append(errorStrings, err.Error())
+	} else {
+		for flagName := range batchValues {
+			u.fileFlags[flagName] = struct{}{}
+		}
+	}
+	for flagName := range u.fileFlags {
+		if _, ok := seenFlags[flagName]; ok {
+			continue
+		}
+		if err := u.resetFlag(flagName); err != nil {
+			errorStrings = append(errorStrings, fmt.Sprintf("flag %v: %v", flagName, err.Error()))
+		} else {
+			u.logger.Printf("flagz: reset flag %v to default, its file is gone", flagName)
 		}
 	}
 	if len(errorStrings) > 0 {
@@ -123,12 +181,44 @@ func (u *Updater) readFlagFile(fullPath string, dynamicOnly bool) error {
 	if dynamicOnly && !flagz.IsFlagDynamic(flag) {
 		return errFlagNotDynamic
 	}
+	if err := flagz.CheckFlagNotFrozen(flag); err != nil {
+		return err
+	}
 	content, err := ioutil.ReadFile(fullPath)
 	if err != nil {
 		return err
 	}
-	// do not call flag.Value.Set, instead go through flagSet.Set to change "changed" state.
-	return u.flagSet.Set(flagName, string(content))
+	u.markSecret(flag)
+	// do not call flag.Value.Set, instead go through flagz.SetFrom to change "changed" state and record the source.
+	if err := flagz.SetFrom(u.flagSet, flagName, string(content), flagz.FileSource(fullPath)); err != nil {
+		return err
+	}
+	if flagz.IsFlagDynamic(flag) {
+		u.fileFlags[flagName] = struct{}{}
+	}
+	return nil
+}
+
+// markSecret marks the flag as secret before its value is set, if this updater reads a Kubernetes Secret.
+func (u *Updater) markSecret(flag *flag.Flag) {
+	if u.secret && !flagz.IsFlagSecret(flag) {
+		flagz.MarkFlagSecret(flag)
+	}
+}
+
+func (u *Updater) resetFlag(flagName string) error {
+	flag := u.flagSet.Lookup(flagName)
+	if flag == nil {
+		return errFlagNotFound
+	}
+	if !flagz.IsFlagDynamic(flag) {
+		return errFlagNotDynamic
+	}
+	if err := flagz.CheckFlagNotFrozen(flag); err != nil {
+		return err
+	}
+	delete(u.fileFlags, flagName)
+	return flagz.ResetFlag(u.flagSet, flagName)
 }
 
 func (u *Updater) watchForUpdates() {
@@ -155,6 +245,17 @@ func (u *Updater) watchForUpdates() {
 						flagName := path.Base(event.Name)
 						u.logger.Printf("flagz: failed setting flag %s: %v", flagName, err.Error())
 					}
+				case fsnotify.Remove:
+					flagName := path.Base(event.Name)
+					if _, ok := u.fileFlags[flagName]; !ok {
+						// not a flag that we've set, nothing to revert
+						continue
+					}
+					if err := u.resetFlag(flagName); err != nil {
+						u.logger.Printf("flagz: failed resetting flag %s: %v", flagName, err.Error())
+					} else {
+						u.logger.Printf("flagz: reset flag %s to default, its file was removed", flagName)
+					}
 				}
 			}
 
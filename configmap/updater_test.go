@@ -27,6 +27,7 @@ const (
 	firstGoodDir  = "..9989_09_09_07_32_32.099817316"
 	secondGoodDir = "..9289_09_10_03_32_32.039823124"
 	badStaticDir  = "..1289_09_10_03_32_32.039823124"
+	noDynamicDir  = "..4289_09_11_03_32_32.039823124"
 )
 
 type updaterTestSuite struct {
@@ -85,6 +86,7 @@ func (s *updaterTestSuite) TestInitializeSetsValues() {
 	require.NoError(s.T(), s.updater.Initialize(), "the updater initialize should not return errors on good flags")
 	assert.EqualValues(s.T(), *s.staticInt, 1234, "staticInt should be some_int from first directory")
 	assert.EqualValues(s.T(), s.dynInt.Get(), 10001, "staticInt should be some_int from first directory")
+	assert.Contains(s.T(), string(flagz.FlagSource(s.flagSet.Lookup("some_dynint"))), "file:", "some_dynint should be attributed to its file")
 }
 
 func (s *updaterTestSuite) TestDynamicUpdatesPropagate() {
@@ -97,6 +99,51 @@ func (s *updaterTestSuite) TestDynamicUpdatesPropagate() {
 		"some_dynint value should change to the value from secondGoodDir")
 }
 
+func (s *updaterTestSuite) TestDynamicRemovalResetsToDefault() {
+	require.NoError(s.T(), s.updater.Initialize(), "the updater initialize should not return errors on good flags")
+	require.NoError(s.T(), s.updater.Start(), "updater start should not return an error")
+	require.EqualValues(s.T(), 10001, s.dynInt.Get(), "some_dynint should be read from first directory")
+	s.linkDataDirTo(noDynamicDir)
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, flagz.SourceDefault,
+		func() interface{} { return flagz.FlagSource(s.flagSet.Lookup("some_dynint")) },
+		"some_dynint should be attributed to its default after it disappears from the ConfigMap")
+	assert.EqualValues(s.T(), 1, s.dynInt.Get(), "some_dynint value should be reset to default")
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, false,
+		func() interface{} { return s.flagSet.Lookup("some_dynint").Changed },
+		"some_dynint should no longer be marked as changed")
+}
+
+func (s *updaterTestSuite) TestFrozenFlagsAreNotUpdated() {
+	require.NoError(s.T(), s.updater.Initialize(), "the updater initialize should not return errors on good flags")
+	require.NoError(s.T(), flagz.Freeze(s.flagSet, "some_dynint", "release freeze"))
+	require.NoError(s.T(), s.updater.Start(), "updater start should not return an error")
+	s.linkDataDirTo(secondGoodDir)
+	time.Sleep(200 * time.Millisecond)
+	assert.EqualValues(s.T(), 10001, s.dynInt.Get(), "frozen some_dynint should keep the value from first directory")
+
+	require.NoError(s.T(), flagz.Unfreeze(s.flagSet, "some_dynint"))
+	s.linkDataDirTo(firstGoodDir)
+	s.linkDataDirTo(secondGoodDir)
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, 20002,
+		func() interface{} { return s.dynInt.Get() },
+		"unfrozen some_dynint value should change to the value from secondGoodDir")
+}
+
+func (s *updaterTestSuite) TestSecretUpdaterMarksFlagsSecret() {
+	secretUpdater, err := configmap.NewForSecret(s.flagSet, path.Join(s.tempDir, "testdata"), &testingLog{T: s.T()})
+	require.NoError(s.T(), err, "creating a secret updater must not fail")
+	require.NoError(s.T(), secretUpdater.Initialize(), "the updater initialize should not return errors on good flags")
+	assert.EqualValues(s.T(), 10001, s.dynInt.Get(), "some_dynint should be read from the secret")
+	assert.True(s.T(), flagz.IsFlagSecret(s.flagSet.Lookup("some_dynint")), "some_dynint should be marked secret")
+	assert.True(s.T(), flagz.IsFlagSecret(s.flagSet.Lookup("some_int")), "some_int should be marked secret")
+	history := s.dynInt.History()
+	require.NotEmpty(s.T(), history)
+	assert.Equal(s.T(), flagz.RedactedValue, history[len(history)-1].NewValue, "the value should be redacted in history")
+}
+
 func TestUpdaterSuite(t *testing.T) {
 	suite.Run(t, &updaterTestSuite{})
 }
@@ -0,0 +1,60 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"strconv"
+
+	flag "github.com/spf13/pflag"
+)
+
+// DynBool creates a `Flag` that represents `bool` which is safe to change dynamically at runtime.
+// Like `pflag.Bool`, it can be set with just `--name` on the command line, and values are parsed with
+// `strconv.ParseBool`.
+func DynBool(flagSet *flag.FlagSet, name string, value bool, usage string) *DynBoolValue {
+	dynValue := &DynBoolValue{NewDynValue[bool](flagSet, name, value, boolCodec{})}
+	flag := flagSet.VarPF(dynValue, name, "", usage)
+	flag.NoOptDefVal = "true"
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynBoolValue is a flag-related `bool` value wrapper.
+type DynBoolValue struct {
+	*DynValue[bool]
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynBoolValue) WithValidator(validator func(bool) error) *DynBoolValue {
+	d.DynValue.WithValidator(validator)
+	return d
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine.
+func (d *DynBoolValue) WithNotifier(notifier func(oldValue bool, newValue bool)) *DynBoolValue {
+	d.DynValue.WithNotifier(notifier)
+	return d
+}
+
+// IsBoolFlag marks the flag as a boolean one for code that follows the convention of the standard `flag` package.
+func (d *DynBoolValue) IsBoolFlag() bool {
+	return true
+}
+
+type boolCodec struct{}
+
+func (boolCodec) Parse(input string) (bool, error) {
+	return strconv.ParseBool(input)
+}
+
+func (boolCodec) Format(value bool) string {
+	return strconv.FormatBool(value)
+}
+
+func (boolCodec) Type() string {
+	return "dyn_bool"
+}
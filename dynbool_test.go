@@ -0,0 +1,70 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynBool_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynBool(set, "some_bool_1", false, "Use it or lose it")
+	assert.Equal(t, false, dynFlag.Get(), "value must be default after create")
+	assert.NoError(t, set.Set("some_bool_1", "T"), "setting value must succeed")
+	assert.Equal(t, true, dynFlag.Get(), "value must be set after update")
+	assert.Error(t, set.Set("some_bool_1", "yes"), "values must be parsed with strconv.ParseBool")
+	assert.Equal(t, true, dynFlag.Get(), "value must not change after a bad update")
+}
+
+func TestDynBool_CommandLineWithoutValue(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	enabled := DynBool(set, "some_bool_1", false, "Use it or lose it")
+	disabled := DynBool(set, "some_bool_2", true, "Use it or lose it")
+	require.NoError(t, set.Parse([]string{"--some_bool_1", "--some_bool_2=false"}))
+	assert.Equal(t, true, enabled.Get(), "flag without a value must be set to true")
+	assert.Equal(t, false, disabled.Get(), "flag with a value must be set to it")
+}
+
+func TestDynBool_IsMarkedDynamic(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynBool(set, "some_bool_1", false, "Use it or lose it")
+	assert.True(t, IsFlagDynamic(set.Lookup("some_bool_1")))
+}
+
+func TestDynBool_FiresValidators(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynBool(set, "some_bool_1", false, "Use it or lose it").WithValidator(func(value bool) error {
+		if value {
+			return fmt.Errorf("can't be enabled during the migration")
+		}
+		return nil
+	})
+
+	assert.NoError(t, set.Set("some_bool_1", "false"), "no error from validator when allowed")
+	assert.Error(t, set.Set("some_bool_1", "true"), "error from validator when not allowed")
+}
+
+func TestDynBool_FiresNotifier(t *testing.T) {
+	waitCh := make(chan bool, 1)
+	notifier := func(oldVal bool, newVal bool) {
+		assert.EqualValues(t, false, oldVal, "old value in notify must match previous value")
+		assert.EqualValues(t, true, newVal, "new value in notify must match set value")
+		waitCh <- true
+	}
+
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynBool(set, "some_bool_1", false, "Use it or lose it").WithNotifier(notifier)
+	set.Set("some_bool_1", "true")
+	select {
+	case <-time.After(5 * time.Millisecond):
+		assert.Fail(t, "failed to trigger notifier")
+	case <-waitCh:
+	}
+}
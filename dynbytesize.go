@@ -0,0 +1,147 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// DynByteSize creates a `Flag` that represents a size in bytes as `uint64`, which is safe to change dynamically at
+// runtime.
+//
+// Values are written with SI units that are powers of 1000 (`KB`, `MB`, `GB`, `TB`, `PB`, `EB`, or just `K`, `M`, ...),
+// or IEC units that are powers of 1024 (`KiB`, `MiB`, `GiB`, `TiB`, `PiB`, `EiB`, or just `Ki`, `Mi`, ...), e.g.
+// `64KiB`, `1.5GB` or `512M`. Like in Kubernetes quantities, `M` is a megabyte and `Mi` a mebibyte. Units are
+// case-insensitive, and values without a unit, or with `B`, are in bytes.
+func DynByteSize(flagSet *flag.FlagSet, name string, value uint64, usage string) *DynByteSizeValue {
+	dynValue := &DynByteSizeValue{NewDynValue[uint64](flagSet, name, value, byteSizeCodec{})}
+	flag := flagSet.VarPF(dynValue, name, "", usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynByteSizeValue is a flag-related `uint64` size in bytes value wrapper.
+type DynByteSizeValue struct {
+	*DynValue[uint64]
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynByteSizeValue) WithValidator(validator func(uint64) error) *DynByteSizeValue {
+	d.DynValue.WithValidator(validator)
+	return d
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine.
+func (d *DynByteSizeValue) WithNotifier(notifier func(oldValue uint64, newValue uint64)) *DynByteSizeValue {
+	d.DynValue.WithNotifier(notifier)
+	return d
+}
+
+// ValidateDynByteSizeRange returns a validator function that checks if the size in bytes is in range.
+func ValidateDynByteSizeRange(fromInclusive uint64, toInclusive uint64) func(uint64) error {
+	return func(value uint64) error {
+		if value > toInclusive || value < fromInclusive {
+			return fmt.Errorf("value %v not in [%v, %v] range", formatByteSize(value), formatByteSize(fromInclusive), formatByteSize(toInclusive))
+		}
+		return nil
+	}
+}
+
+type byteSizeUnit struct {
+	name       string
+	multiplier uint64
+}
+
+// byteSizeUnits are ordered from the largest, and IEC units come before SI ones of the same prefix.
+var byteSizeUnits = []byteSizeUnit{
+	{"EiB", 1 << 60}, {"EB", 1e18},
+	{"PiB", 1 << 50}, {"PB", 1e15},
+	{"TiB", 1 << 40}, {"TB", 1e12},
+	{"GiB", 1 << 30}, {"GB", 1e9},
+	{"MiB", 1 << 20}, {"MB", 1e6},
+	{"KiB", 1 << 10}, {"KB", 1e3},
+	{"B", 1},
+}
+
+func parseByteSizeUnit(unit string) (uint64, bool) {
+	unit = strings.ToUpper(unit)
+	for _, u := range byteSizeUnits {
+		name := strings.ToUpper(u.name)
+		if unit == name || (u.multiplier > 1 && unit == strings.TrimSuffix(name, "B")) {
+			return u.multiplier, true
+		}
+	}
+	return 0, unit == ""
+}
+
+func parseByteSize(input string) (uint64, error) {
+	input = strings.TrimSpace(input)
+	split := strings.IndexFunc(input, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if split < 0 {
+		split = len(input)
+	}
+	number, unit := input[:split], strings.TrimSpace(input[split:])
+	multiplier, ok := parseByteSizeUnit(unit)
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q in size %q", unit, input)
+	}
+	if multiplier == 0 {
+		// no unit, the number is in bytes
+		multiplier = 1
+	}
+	size, ok := new(big.Rat).SetString(number)
+	if !ok || number == "" || strings.ContainsAny(number, "/eE") {
+		return 0, fmt.Errorf("bad number in size %q", input)
+	}
+	size.Mul(size, new(big.Rat).SetUint64(multiplier))
+	if !size.IsInt() {
+		return 0, fmt.Errorf("size %q is not a whole number of bytes", input)
+	}
+	if !size.Num().IsUint64() {
+		return 0, fmt.Errorf("size %q is too large", input)
+	}
+	return size.Num().Uint64(), nil
+}
+
+// formatByteSize formats the size with the largest unit that divides it. If both an IEC and an SI unit divide it,
+// the one giving the shorter number is used.
+func formatByteSize(value uint64) string {
+	if value == 0 {
+		return "0B"
+	}
+	best := ""
+	for _, u := range byteSizeUnits {
+		if value%u.multiplier != 0 {
+			continue
+		}
+		formatted := fmt.Sprintf("%d%s", value/u.multiplier, u.name)
+		if best == "" || len(formatted) < len(best) {
+			best = formatted
+		}
+	}
+	return best
+}
+
+type byteSizeCodec struct{}
+
+func (byteSizeCodec) Parse(input string) (uint64, error) {
+	return parseByteSize(input)
+}
+
+func (byteSizeCodec) Format(value uint64) string {
+	return formatByteSize(value)
+}
+
+func (byteSizeCodec) Type() string {
+	return "dyn_bytesize"
+}
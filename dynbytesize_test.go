@@ -0,0 +1,114 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynByteSize_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynByteSize(set, "some_bytesize_1", 64<<10, "Use it or lose it")
+	assert.Equal(t, uint64(64<<10), dynFlag.Get(), "value must be default after create")
+	assert.Equal(t, "64KiB", dynFlag.String(), "value must be formatted with units")
+	err := set.Set("some_bytesize_1", "1.5GB")
+	assert.NoError(t, err, "setting value must succeed")
+	assert.Equal(t, uint64(1500000000), dynFlag.Get(), "value must be set after update")
+}
+
+func TestDynByteSize_Parse(t *testing.T) {
+	for input, expected := range map[string]uint64{
+		"0":        0,
+		"123":      123,
+		"123B":     123,
+		"64KiB":    64 << 10,
+		"64Ki":     64 << 10,
+		"64kib":    64 << 10,
+		"1.5GB":    1500000000,
+		"1.5GiB":   3 << 29,
+		"512M":     512000000,
+		"512Mi":    512 << 20,
+		" 2 TB ":   2000000000000,
+		"0.5KiB":   512,
+		"16EiB":    0, // overflows
+		"1.5B":     0, // not whole
+		"1.5":      0, // not whole
+		"12XB":     0, // unknown unit
+		"KB":       0, // no number
+		"1e3":      0, // exponents are not supported
+		"-1KB":     0, // negative
+		"1/2KiB":   0, // fractions are not supported
+		"1.2.3KiB": 0, // bad number
+	} {
+		got, err := parseByteSize(input)
+		if expected == 0 && input != "0" {
+			assert.Error(t, err, "parsing %q must fail", input)
+			continue
+		}
+		if assert.NoError(t, err, "parsing %q must succeed", input) {
+			assert.Equal(t, expected, got, "parsing %q", input)
+		}
+	}
+}
+
+func TestDynByteSize_FormatIsCanonical(t *testing.T) {
+	for value, expected := range map[uint64]string{
+		0:          "0B",
+		1:          "1B",
+		1536:       "1536B",
+		64 << 10:   "64KiB",
+		1000000:    "1MB",
+		1 << 20:    "1MiB",
+		1024000:    "1024KB",
+		1500000000: "1500MB",
+		1<<64 - 1:  "18446744073709551615B",
+		1 << 60:    "1EiB",
+		2e15:       "2PB",
+	} {
+		formatted := formatByteSize(value)
+		assert.Equal(t, expected, formatted, "formatting %d", value)
+		parsed, err := parseByteSize(formatted)
+		require.NoError(t, err, "formatted %q must parse back", formatted)
+		assert.Equal(t, value, parsed, "formatted %q must parse back to the same value", formatted)
+	}
+}
+
+func TestDynByteSize_IsMarkedDynamic(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynByteSize(set, "some_bytesize_1", 64<<10, "Use it or lose it")
+	assert.True(t, IsFlagDynamic(set.Lookup("some_bytesize_1")))
+}
+
+func TestDynByteSize_FiresValidators(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynByteSize(set, "some_bytesize_1", 64<<10, "Use it or lose it").WithValidator(ValidateDynByteSizeRange(1<<10, 1<<20))
+
+	assert.NoError(t, set.Set("some_bytesize_1", "512KiB"), "no error from validator when in range")
+	err := set.Set("some_bytesize_1", "2MiB")
+	require.Error(t, err, "error from validator when value out of range")
+	assert.Contains(t, err.Error(), "2MiB not in [1KiB, 1MiB] range", "error must use units")
+}
+
+func TestDynByteSize_FiresNotifier(t *testing.T) {
+	waitCh := make(chan bool, 1)
+	notifier := func(oldVal uint64, newVal uint64) {
+		assert.EqualValues(t, 64<<10, oldVal, "old value in notify must match previous value")
+		assert.EqualValues(t, 1<<20, newVal, "new value in notify must match set value")
+		waitCh <- true
+	}
+
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynByteSize(set, "some_bytesize_1", 64<<10, "Use it or lose it").WithNotifier(notifier)
+	set.Set("some_bytesize_1", "1MiB")
+	select {
+	case <-time.After(5 * time.Millisecond):
+		assert.Fail(t, "failed to trigger notifier")
+	case <-waitCh:
+	}
+}
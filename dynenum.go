@@ -0,0 +1,157 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	flag "github.com/spf13/pflag"
+)
+
+// DynEnum creates a `Flag` that represents a `string` constrained to the `allowed` values, which is safe to change
+// dynamically at runtime. Values that are not allowed are rejected when parsed, before any validators run.
+// It panics if the default `value` is not allowed.
+func DynEnum(flagSet *flag.FlagSet, name string, allowed []string, value string, usage string) *DynEnumValue {
+	codec := &enumCodec{}
+	codec.spec.Store(&enumSpec{allowed: append([]string(nil), allowed...), aliases: map[string]string{}})
+	if _, err := codec.Parse(value); err != nil {
+		panic(fmt.Sprintf("flagz: default of DynEnum %v: %v", name, err))
+	}
+	dynValue := &DynEnumValue{NewDynValue[string](flagSet, name, value, codec), codec}
+	flag := flagSet.VarPF(dynValue, name, "", usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynEnumValue is a flag-related enum `string` value wrapper.
+type DynEnumValue struct {
+	*DynValue[string]
+	codec *enumCodec
+}
+
+// AllowedValues returns the values the flag can be set to, not including aliases.
+func (d *DynEnumValue) AllowedValues() []string {
+	return append([]string(nil), d.codec.spec.Load().allowed...)
+}
+
+// WithCaseInsensitive makes the flag accept allowed values and aliases regardless of case, e.g. `Deny` for `deny`.
+// The value is stored as it is spelled in the allowed values.
+func (d *DynEnumValue) WithCaseInsensitive() *DynEnumValue {
+	d.codec.update(func(spec *enumSpec) error {
+		spec.caseInsensitive = true
+		return nil
+	})
+	return d
+}
+
+// WithAlias makes the flag accept a deprecated `alias` of the allowed `value`, e.g. `block` for `deny`, so that old
+// configuration keeps working. The value is stored as the allowed `value`, not as the alias.
+// It panics if the `value` is not allowed.
+func (d *DynEnumValue) WithAlias(alias string, value string) *DynEnumValue {
+	err := d.codec.update(func(spec *enumSpec) error {
+		if !spec.isAllowed(value) {
+			return fmt.Errorf("alias %q of %q, which is not one of %v", alias, value, spec.allowed)
+		}
+		spec.aliases[alias] = value
+		return nil
+	})
+	if err != nil {
+		panic(fmt.Sprintf("flagz: DynEnum %v: %v", d.flagName, err))
+	}
+	return d
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynEnumValue) WithValidator(validator func(string) error) *DynEnumValue {
+	d.DynValue.WithValidator(validator)
+	return d
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine.
+func (d *DynEnumValue) WithNotifier(notifier func(oldValue string, newValue string)) *DynEnumValue {
+	d.DynValue.WithNotifier(notifier)
+	return d
+}
+
+type enumValue interface {
+	AllowedValues() []string
+}
+
+// FlagAllowedValues returns the values an enum flag, such as `DynEnum`, can be set to, or nil for other flags.
+// It is meant for code that describes flags, e.g. the `/debug/flagz` page or generators of configuration schemas.
+func FlagAllowedValues(f *flag.Flag) []string {
+	if ev, ok := f.Value.(enumValue); ok {
+		return ev.AllowedValues()
+	}
+	return nil
+}
+
+type enumSpec struct {
+	allowed         []string
+	aliases         map[string]string
+	caseInsensitive bool
+}
+
+func (s *enumSpec) isAllowed(value string) bool {
+	for _, a := range s.allowed {
+		if a == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *enumSpec) equal(a string, b string) bool {
+	if s.caseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// enumCodec parses values of a `DynEnum`. Its spec is copied on write, since the flag may be parsed concurrently with
+// the `With*` methods that change it.
+type enumCodec struct {
+	spec atomic.Pointer[enumSpec]
+}
+
+func (c *enumCodec) update(fn func(spec *enumSpec) error) error {
+	old := c.spec.Load()
+	spec := &enumSpec{allowed: old.allowed, aliases: make(map[string]string, len(old.aliases)), caseInsensitive: old.caseInsensitive}
+	for k, v := range old.aliases {
+		spec.aliases[k] = v
+	}
+	if err := fn(spec); err != nil {
+		return err
+	}
+	c.spec.Store(spec)
+	return nil
+}
+
+func (c *enumCodec) Parse(input string) (string, error) {
+	spec := c.spec.Load()
+	for _, a := range spec.allowed {
+		if spec.equal(a, input) {
+			return a, nil
+		}
+	}
+	for alias, value := range spec.aliases {
+		if spec.equal(alias, input) {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("value %q is not one of %v", input, spec.allowed)
+}
+
+func (c *enumCodec) Format(value string) string {
+	return value
+}
+
+func (c *enumCodec) Type() string {
+	return "dyn_enum"
+}
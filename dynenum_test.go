@@ -0,0 +1,91 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testPolicies = []string{"allow", "deny", "shadow"}
+
+func TestDynEnum_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynEnum(set, "some_enum_1", testPolicies, "allow", "Use it or lose it")
+	assert.Equal(t, "allow", dynFlag.Get(), "value must be default after create")
+	assert.NoError(t, set.Set("some_enum_1", "deny"), "setting an allowed value must succeed")
+	assert.Equal(t, "deny", dynFlag.Get(), "value must be set after update")
+	assert.Error(t, set.Set("some_enum_1", "block"), "setting an unknown value must fail")
+	assert.Error(t, set.Set("some_enum_1", "Deny"), "values must be case-sensitive by default")
+	assert.Equal(t, "deny", dynFlag.Get(), "value must not change after a bad update")
+}
+
+func TestDynEnum_DefaultMustBeAllowed(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	assert.Panics(t, func() {
+		DynEnum(set, "some_enum_1", testPolicies, "block", "Use it or lose it")
+	})
+}
+
+func TestDynEnum_CaseInsensitive(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynEnum(set, "some_enum_1", testPolicies, "allow", "Use it or lose it").WithCaseInsensitive()
+	require.NoError(t, set.Set("some_enum_1", "SHADOW"))
+	assert.Equal(t, "shadow", dynFlag.Get(), "value must be stored as spelled in allowed values")
+}
+
+func TestDynEnum_DeprecatedAliases(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynEnum(set, "some_enum_1", testPolicies, "allow", "Use it or lose it").
+		WithAlias("block", "deny").
+		WithCaseInsensitive()
+	require.NoError(t, set.Set("some_enum_1", "Block"))
+	assert.Equal(t, "deny", dynFlag.Get(), "alias must be stored as its allowed value")
+	assert.Equal(t, testPolicies, dynFlag.AllowedValues(), "aliases must not be listed as allowed values")
+	assert.Panics(t, func() { dynFlag.WithAlias("yolo", "unknown") }, "aliases must be of allowed values")
+}
+
+func TestDynEnum_FlagAllowedValues(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynEnum(set, "some_enum_1", testPolicies, "allow", "Use it or lose it")
+	DynString(set, "some_string_1", "allow", "Use it or lose it")
+	assert.Equal(t, testPolicies, FlagAllowedValues(set.Lookup("some_enum_1")))
+	assert.Nil(t, FlagAllowedValues(set.Lookup("some_string_1")))
+}
+
+func TestDynEnum_FiresValidators(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynEnum(set, "some_enum_1", testPolicies, "allow", "Use it or lose it").WithValidator(func(value string) error {
+		if value == "shadow" {
+			return fmt.Errorf("shadow mode is not ready yet")
+		}
+		return nil
+	})
+
+	assert.NoError(t, set.Set("some_enum_1", "deny"), "no error from validator when allowed")
+	assert.Error(t, set.Set("some_enum_1", "shadow"), "error from validator when not allowed")
+}
+
+func TestDynEnum_FiresNotifier(t *testing.T) {
+	waitCh := make(chan bool, 1)
+	notifier := func(oldVal string, newVal string) {
+		assert.EqualValues(t, "allow", oldVal, "old value in notify must match previous value")
+		assert.EqualValues(t, "deny", newVal, "new value in notify must match set value")
+		waitCh <- true
+	}
+
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynEnum(set, "some_enum_1", testPolicies, "allow", "Use it or lose it").WithNotifier(notifier)
+	set.Set("some_enum_1", "deny")
+	select {
+	case <-time.After(5 * time.Millisecond):
+		assert.Fail(t, "failed to trigger notifier")
+	case <-waitCh:
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"encoding/csv"
+	"fmt"
+	"path"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// DynGlob creates a `Flag` that represents a glob pattern, as matched by `path.Match`, which is safe to change
+// dynamically at runtime. Invalid patterns are rejected when they are set. An empty pattern matches nothing, e.g. to
+// disable matching.
+//
+// It panics if the default `value` is not a valid pattern.
+func DynGlob(flagSet *flag.FlagSet, name string, value string, usage string) *DynGlobValue {
+	if err := checkGlob(value); err != nil {
+		panic(fmt.Sprintf("flagz: default of DynGlob %v: %v", name, err))
+	}
+	dynValue := &DynGlobValue{NewDynValue[string](flagSet, name, value, globCodec{})}
+	flag := flagSet.VarPF(dynValue, name, "", usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynGlobValue is a flag-related glob pattern `string` value wrapper.
+type DynGlobValue struct {
+	*DynValue[string]
+}
+
+// Match reports whether the current pattern matches `name`, like `path.Match`. It returns false if the pattern is
+// empty.
+func (d *DynGlobValue) Match(name string) bool {
+	pattern := d.Get()
+	if pattern == "" {
+		return false
+	}
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynGlobValue) WithValidator(validator func(string) error) *DynGlobValue {
+	d.DynValue.WithValidator(validator)
+	return d
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine.
+func (d *DynGlobValue) WithNotifier(notifier func(oldValue string, newValue string)) *DynGlobValue {
+	d.DynValue.WithNotifier(notifier)
+	return d
+}
+
+// DynGlobList creates a `Flag` that represents a list of glob patterns, as matched by `path.Match`, which is safe to
+// change dynamically at runtime. Like `DynStringSlice`, the patterns are comma-separated, and patterns containing
+// commas, e.g. `/v[12,]/*`, must be quoted as in CSV.
+//
+// It panics if any of the default patterns is not valid.
+func DynGlobList(flagSet *flag.FlagSet, name string, value []string, usage string) *DynGlobListValue {
+	for _, pattern := range value {
+		if err := checkGlob(pattern); err != nil {
+			panic(fmt.Sprintf("flagz: default of DynGlobList %v: %v", name, err))
+		}
+	}
+	value = append([]string(nil), value...)
+	dynValue := &DynGlobListValue{NewDynValue[[]string](flagSet, name, value, globListCodec{})}
+	flag := flagSet.VarPF(dynValue, name, "", usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynGlobListValue is a flag-related `[]string` glob pattern list value wrapper.
+//
+// The slice returned by `Get` is shared by all readers of the flag and must not be modified, use `View` to read it
+// safely, or `View().Copy()` to get a slice the caller owns.
+type DynGlobListValue struct {
+	*DynValue[[]string]
+}
+
+// View returns a read-only view of the current value.
+func (d *DynGlobListValue) View() SliceView[string] {
+	return SliceView[string]{items: d.Get()}
+}
+
+// Match reports whether any of the current patterns matches `name`, like `path.Match`.
+func (d *DynGlobListValue) Match(name string) bool {
+	for _, pattern := range d.Get() {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynGlobListValue) WithValidator(validator func([]string) error) *DynGlobListValue {
+	d.DynValue.WithValidator(validator)
+	return d
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine.
+func (d *DynGlobListValue) WithNotifier(notifier func(oldValue []string, newValue []string)) *DynGlobListValue {
+	d.DynValue.WithNotifier(notifier)
+	return d
+}
+
+// checkGlob returns an error if `path.Match` would reject the pattern, which it checks as a whole even if it doesn't
+// match.
+func checkGlob(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("pattern %q is not a valid glob: %v", pattern, err)
+	}
+	return nil
+}
+
+type globCodec struct{}
+
+func (globCodec) Parse(input string) (string, error) {
+	if err := checkGlob(input); err != nil {
+		return "", err
+	}
+	return input, nil
+}
+
+func (globCodec) Format(value string) string {
+	return value
+}
+
+func (globCodec) Type() string {
+	return "dyn_glob"
+}
+
+type globListCodec struct{}
+
+func (globListCodec) Parse(input string) ([]string, error) {
+	if strings.TrimSpace(input) == "" {
+		return []string{}, nil
+	}
+	patterns, err := csv.NewReader(strings.NewReader(input)).Read()
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range patterns {
+		if err := checkGlob(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return patterns, nil
+}
+
+func (globListCodec) Format(value []string) string {
+	return formatCSV(value)
+}
+
+func (globListCodec) Type() string {
+	return "dyn_globlist"
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynGlob_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynGlob(set, "some_glob_1", "/api/*", "Use it or lose it")
+	assert.Equal(t, "/api/*", dynFlag.Get(), "value must be default after create")
+	assert.True(t, dynFlag.Match("/api/foo"))
+	assert.False(t, dynFlag.Match("/api/foo/bar"), "stars must not match slashes")
+
+	require.NoError(t, set.Set("some_glob_1", "/v[12]/*/status"), "setting value must succeed")
+	assert.True(t, dynFlag.Match("/v2/foo/status"), "value must be set after update")
+
+	assert.Error(t, set.Set("some_glob_1", "/v[12/*"), "invalid patterns must be rejected")
+	assert.Error(t, set.Set("some_glob_1", "/api/*/\\"), "patterns that are invalid after a mismatch must be rejected")
+	assert.Equal(t, "/v[12]/*/status", dynFlag.Get(), "value must not change after a bad update")
+
+	require.NoError(t, set.Set("some_glob_1", ""))
+	assert.False(t, dynFlag.Match(""), "empty pattern must not match anything")
+}
+
+func TestDynGlob_PanicsOnBadDefault(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	assert.Panics(t, func() {
+		DynGlob(set, "some_glob_1", "[", "Use it or lose it")
+	})
+}
+
+func TestDynGlob_FiresValidators(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynGlob(set, "some_glob_1", "", "Use it or lose it").WithValidator(func(pattern string) error {
+		if !strings.HasPrefix(pattern, "/") {
+			return fmt.Errorf("patterns must be absolute paths")
+		}
+		return nil
+	})
+
+	assert.NoError(t, set.Set("some_glob_1", "/api/*"), "no error from validator when allowed")
+	assert.Error(t, set.Set("some_glob_1", "*"), "error from validator when not allowed")
+}
+
+func TestDynGlobList_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynGlobList(set, "some_globlist_1", []string{"/api/*"}, "Use it or lose it")
+	assert.Equal(t, "/api/*", dynFlag.String(), "value must be default after create")
+
+	require.NoError(t, set.Set("some_globlist_1", `/debug/*,"/v[12,]/*"`), "setting value must succeed")
+	assert.Equal(t, []string{"/debug/*", "/v[12,]/*"}, dynFlag.View().Copy())
+	assert.True(t, dynFlag.Match("/debug/vars"))
+	assert.True(t, dynFlag.Match("/v,/foo"))
+	assert.False(t, dynFlag.Match("/api/foo"), "value must be set after update")
+
+	assert.Error(t, set.Set("some_globlist_1", "/api/*,/v[12"), "lists with an invalid pattern must be rejected")
+	assert.Equal(t, 2, dynFlag.View().Len(), "value must not change after a bad update")
+
+	require.NoError(t, set.Set("some_globlist_1", ""))
+	assert.False(t, dynFlag.Match("/debug/vars"), "empty list must not match anything")
+}
+
+func TestDynGlobList_PanicsOnBadDefault(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	assert.Panics(t, func() {
+		DynGlobList(set, "some_globlist_1", []string{"/api/*", "["}, "Use it or lose it")
+	})
+}
+
+func TestDynGlobList_IsMarkedDynamic(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynGlobList(set, "some_globlist_1", nil, "Use it or lose it")
+	assert.True(t, IsFlagDynamic(set.Lookup("some_globlist_1")))
+}
@@ -34,6 +34,17 @@ func TestDynInt64_FiresValidators(t *testing.T) {
 	assert.Error(t, set.Set("some_int_1", "2001"), "error from validator when value out of range")
 }
 
+func TestDynInt64_ChainsValidators(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynInt64(set, "some_int_1", 13371337, "Use it or lose it").
+		WithValidator(ValidateDynInt64Range(0, 2000)).
+		WithValidator(ValidateDynInt64Range(1000, 3000))
+
+	assert.NoError(t, set.Set("some_int_1", "1500"), "no error from validators when in both ranges")
+	assert.Error(t, set.Set("some_int_1", "500"), "error from second validator must not be clobbered")
+	assert.Error(t, set.Set("some_int_1", "2500"), "error from first validator must not be clobbered")
+}
+
 func TestDynInt64_FiresNotifier(t *testing.T) {
 	waitCh := make(chan bool, 1)
 	notifier := func(oldVal int64, newVal int64) {
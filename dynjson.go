@@ -6,8 +6,6 @@ package flagz
 import (
 	"encoding/json"
 	"reflect"
-	"sync/atomic"
-	"unsafe"
 
 	flag "github.com/spf13/pflag"
 )
@@ -20,12 +18,8 @@ func DynJSON(flagSet *flag.FlagSet, name string, value interface{}, usage string
 	if reflectVal.Kind() != reflect.Ptr || reflectVal.Elem().Kind() != reflect.Struct {
 		panic("DynJSON value must be a pointer to a struct")
 	}
-	dynValue := &DynJSONValue{
-		ptr:        unsafe.Pointer(reflectVal.Pointer()),
-		structType: reflectVal.Type().Elem(),
-		flagSet:    flagSet,
-		flagName: name,
-	}
+	codec := &jsonCodec{structType: reflectVal.Type().Elem()}
+	dynValue := &DynJSONValue{NewDynValue[interface{}](flagSet, name, value, codec)}
 	f := flagSet.VarPF(dynValue, name, "", usage)
 	f.DefValue = dynValue.usageString()
 	MarkFlagDynamic(f)
@@ -34,52 +28,21 @@ func DynJSON(flagSet *flag.FlagSet, name string, value interface{}, usage string
 
 // DynJSONValue is a flag-related JSON struct value wrapper.
 type DynJSONValue struct {
-	structType reflect.Type
-	ptr        unsafe.Pointer
-	validator  func(interface{}) error
-	notifier   func(oldValue interface{}, newValue interface{})
-	flagName   string
-	flagSet    *flag.FlagSet
-}
-
-// Get retrieves the value in its original JSON struct type in a thread-safe manner.
-func (d *DynJSONValue) Get() interface{} {
-	return d.unsafeToStoredType(atomic.LoadPointer(&d.ptr))
-}
-
-// Set updates the value from a string representation in a thread-safe manner.
-// This operation may return an error if the provided `input` doesn't parse, or the resulting value doesn't pass an
-// optional validator.
-// If a notifier is set on the value, it will be invoked in a separate go-routine.
-func (d *DynJSONValue) Set(input string) error {
-	someStruct := reflect.New(d.structType).Interface()
-	if err := json.Unmarshal([]byte(input), someStruct); err != nil {
-		return err
-	}
-	if d.validator != nil {
-		if err := d.validator(someStruct); err != nil {
-			return err
-		}
-	}
-	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(reflect.ValueOf(someStruct).Pointer()))
-	if d.notifier != nil {
-		go d.notifier(d.unsafeToStoredType(oldPtr), someStruct)
-	}
-	return nil
+	*DynValue[interface{}]
 }
 
 // WithValidator adds a function that checks values before they're set.
 // Any error returned by the validator will lead to the value being rejected.
 // Validators are executed on the same go-routine as the call to `Set`.
 func (d *DynJSONValue) WithValidator(validator func(interface{}) error) *DynJSONValue {
-	d.validator = validator
+	d.DynValue.WithValidator(validator)
 	return d
 }
 
 // WithNotifier adds a function is called every time a new value is successfully set.
 // Each notifier is executed in a new go-routine.
 func (d *DynJSONValue) WithNotifier(notifier func(oldValue interface{}, newValue interface{})) *DynJSONValue {
-	d.notifier = notifier
+	d.DynValue.WithNotifier(notifier)
 	return d
 }
 
@@ -90,16 +53,10 @@ func (d *DynJSONValue) WithNotifier(notifier func(oldValue interface{}, newValue
 //
 // Flag value reads are subject to notifiers and validators.
 func (d *DynJSONValue) WithFileFlag(defaultPath string) *DynJSONValue {
-	FileReadFlag(d.flagSet, d.flagName, defaultPath)
+	d.DynValue.WithFileFlag(defaultPath)
 	return d
 }
 
-
-// Type is an indicator of what this flag represents.
-func (d *DynJSONValue) Type() string {
-	return "dyn_json"
-}
-
 // PrettyString returns a nicely structured representation of the type.
 // In this case it returns a pretty-printed JSON.
 func (d *DynJSONValue) PrettyString() string {
@@ -110,16 +67,97 @@ func (d *DynJSONValue) PrettyString() string {
 	return string(out)
 }
 
-// String returns the canonical string representation of the type.
-func (d *DynJSONValue) String() string {
-	out, err := json.Marshal(d.Get())
+func (d *DynJSONValue) usageString() string {
+	s := d.String()
+	if len(s) > 128 {
+		return "{ ... truncated ... }"
+	} else {
+		return s
+	}
+}
+
+type jsonCodec struct {
+	structType reflect.Type
+}
+
+func (c *jsonCodec) Parse(input string) (interface{}, error) {
+	someStruct := reflect.New(c.structType).Interface()
+	if err := json.Unmarshal([]byte(input), someStruct); err != nil {
+		return nil, err
+	}
+	return someStruct, nil
+}
+
+func (c *jsonCodec) Format(value interface{}) string {
+	out, err := json.Marshal(value)
 	if err != nil {
 		return "ERR"
 	}
 	return string(out)
 }
 
-func (d *DynJSONValue) usageString() string {
+func (c *jsonCodec) Canonical(value interface{}) string {
+	return canonicalJSONOrErr(c.Format(value))
+}
+
+func (c *jsonCodec) Type() string {
+	return "dyn_json"
+}
+
+// DynJSONOf creates a `Flag` that is backed by a JSON struct of type `T` which is safe to change dynamically at runtime.
+// Unlike `DynJSON`, the value is statically typed: `Get` returns a `*T` without any type assertions or reflection.
+// A new `T` will be created and unmarshalled into on each update, so values returned by `Get` must be treated as
+// read-only.
+func DynJSONOf[T any](flagSet *flag.FlagSet, name string, value *T, usage string) *DynJSONOfValue[T] {
+	dynValue := &DynJSONOfValue[T]{NewDynValue[*T](flagSet, name, value, typedJSONCodec[T]{})}
+	f := flagSet.VarPF(dynValue, name, "", usage)
+	f.DefValue = dynValue.usageString()
+	MarkFlagDynamic(f)
+	return dynValue
+}
+
+// DynJSONOfValue is a flag-related wrapper of a JSON struct of type `T`.
+type DynJSONOfValue[T any] struct {
+	*DynValue[*T]
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynJSONOfValue[T]) WithValidator(validator func(*T) error) *DynJSONOfValue[T] {
+	d.DynValue.WithValidator(validator)
+	return d
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine.
+func (d *DynJSONOfValue[T]) WithNotifier(notifier func(oldValue *T, newValue *T)) *DynJSONOfValue[T] {
+	d.DynValue.WithNotifier(notifier)
+	return d
+}
+
+// WithFileFlag adds an companion <name>_path flag that allows this value to be read from a file with flagz.ReadFileFlags.
+//
+// This is useful for reading large JSON files as flags. If the companion flag's value (whether default or overwritten)
+// is set to empty string, nothing is read.
+//
+// Flag value reads are subject to notifiers and validators.
+func (d *DynJSONOfValue[T]) WithFileFlag(defaultPath string) *DynJSONOfValue[T] {
+	d.DynValue.WithFileFlag(defaultPath)
+	return d
+}
+
+// PrettyString returns a nicely structured representation of the type.
+// In this case it returns a pretty-printed JSON.
+func (d *DynJSONOfValue[T]) PrettyString() string {
+	out, err := json.MarshalIndent(d.Get(), "", "  ")
+	if err != nil {
+		return "ERR"
+	}
+	return string(out)
+}
+
+func (d *DynJSONOfValue[T]) usageString() string {
 	s := d.String()
 	if len(s) > 128 {
 		return "{ ... truncated ... }"
@@ -128,7 +166,28 @@ func (d *DynJSONValue) usageString() string {
 	}
 }
 
-func (d *DynJSONValue) unsafeToStoredType(p unsafe.Pointer) interface{} {
-	n := reflect.NewAt(d.structType, p)
-	return n.Interface()
+type typedJSONCodec[T any] struct{}
+
+func (typedJSONCodec[T]) Parse(input string) (*T, error) {
+	someStruct := new(T)
+	if err := json.Unmarshal([]byte(input), someStruct); err != nil {
+		return nil, err
+	}
+	return someStruct, nil
+}
+
+func (typedJSONCodec[T]) Format(value *T) string {
+	out, err := json.Marshal(value)
+	if err != nil {
+		return "ERR"
+	}
+	return string(out)
+}
+
+func (c typedJSONCodec[T]) Canonical(value *T) string {
+	return canonicalJSONOrErr(c.Format(value))
+}
+
+func (typedJSONCodec[T]) Type() string {
+	return "dyn_json"
 }
@@ -89,3 +89,89 @@ type outerJSON struct {
 type innerJSON struct {
 	FieldBool bool `json:"bool"`
 }
+
+func TestDynJSONOf_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynJSONOf(set, "some_json_1", defaultJSON, "Use it or lose it")
+
+	assert.EqualValues(t, defaultJSON, dynFlag.Get(), "value must be default after create")
+
+	err := set.Set("some_json_1", `{"ints": [42], "string": "new-value", "inner": { "bool": false } }`)
+	assert.NoError(t, err, "setting value must succeed")
+	assert.EqualValues(t,
+		&outerJSON{FieldInts: []int{42}, FieldString: "new-value", FieldInner: &innerJSON{FieldBool: false}},
+		dynFlag.Get(),
+		"value must be set after update")
+	assert.Error(t, set.Set("some_json_1", `{"ints": "notints"}`), "setting a bad JSON must fail")
+}
+
+func TestDynJSONOf_IsMarkedDynamic(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynJSONOf(set, "some_json_1", defaultJSON, "Use it or lose it")
+	assert.True(t, IsFlagDynamic(set.Lookup("some_json_1")))
+}
+
+func TestDynJSONOf_FiresValidators(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+
+	validator := func(val *outerJSON) error {
+		if val.FieldString == "" {
+			return fmt.Errorf("FieldString must not be empty")
+		}
+		return nil
+	}
+
+	DynJSONOf(set, "some_json_1", defaultJSON, "Use it or lose it").WithValidator(validator)
+
+	assert.NoError(t, set.Set("some_json_1", `{"ints": [42], "string":"bar"}`), "no error from validator when inputo k")
+	assert.Error(t, set.Set("some_json_1", `{"ints": [42]}`), "error from validator when value out of range")
+}
+
+func TestDynJSONOf_FiresNotifier(t *testing.T) {
+	waitCh := make(chan bool, 1)
+	notifier := func(oldVal *outerJSON, newVal *outerJSON) {
+		assert.EqualValues(t, defaultJSON, oldVal, "old value in notify must match previous value")
+		assert.EqualValues(t, &outerJSON{FieldInts: []int{42}, FieldString: "bar"}, newVal, "new value in notify must match set value")
+		waitCh <- true
+	}
+
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynJSONOf(set, "some_json_1", defaultJSON, "Use it or lose it").WithNotifier(notifier)
+	set.Set("some_json_1", `{"ints": [42], "string":"bar"}`)
+	select {
+	case <-time.After(5 * time.Millisecond):
+		assert.Fail(t, "failed to trigger notifier")
+	case <-waitCh:
+	}
+}
+
+func TestDynJSONOf_GetDoesNotAllocate(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynJSONOf(set, "some_json_1", defaultJSON, "Use it or lose it")
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = dynFlag.Get().FieldString
+	})
+	assert.Zero(t, allocs, "reading a typed JSON flag must not allocate")
+}
+
+func Benchmark_JSON_Dyn_Get(b *testing.B) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynJSON(set, "some_json_1", defaultJSON, "Use it or lose it")
+	set.Set("some_json_1", `{"ints": [42], "string":"bar"}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		x := value.Get().(*outerJSON)
+		_ = x.FieldString
+	}
+}
+
+func Benchmark_JSONOf_Dyn_Get(b *testing.B) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynJSONOf(set, "some_json_1", defaultJSON, "Use it or lose it")
+	set.Set("some_json_1", `{"ints": [42], "string":"bar"}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		x := value.Get()
+		_ = x.FieldString
+	}
+}
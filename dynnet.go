@@ -0,0 +1,387 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	flag "github.com/spf13/pflag"
+)
+
+// DynIPNetList creates a `Flag` that represents a list of CIDR networks, e.g. an IP allow list, which is safe to
+// change dynamically at runtime. Like `DynStringSlice`, the networks are comma-separated, e.g.
+// `10.0.0.0/8,2001:db8::/32`, and plain IP addresses are taken as single-address networks.
+func DynIPNetList(flagSet *flag.FlagSet, name string, value []*net.IPNet, usage string) *DynIPNetListValue {
+	dynValue := &DynIPNetListValue{NewDynValue[*IPNetList](flagSet, name, NewIPNetList(value), ipNetListCodec{})}
+	flag := flagSet.VarPF(dynValue, name, "", usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynIPNetListValue is a flag-related `*IPNetList` value wrapper.
+//
+// The list returned by `Get` is shared by all readers of the flag, its networks can only be read through `View`, which
+// hands out copies of them.
+type DynIPNetListValue struct {
+	*DynValue[*IPNetList]
+}
+
+// Contains returns whether the IP address is in any of the networks of the current value.
+func (d *DynIPNetListValue) Contains(ip net.IP) bool {
+	return d.Get().Contains(ip)
+}
+
+// View returns a read-only view of the networks of the current value.
+func (d *DynIPNetListValue) View() SliceView[*net.IPNet] {
+	return d.Get().View()
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynIPNetListValue) WithValidator(validator func(*IPNetList) error) *DynIPNetListValue {
+	d.DynValue.WithValidator(validator)
+	return d
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine.
+func (d *DynIPNetListValue) WithNotifier(notifier func(oldValue *IPNetList, newValue *IPNetList)) *DynIPNetListValue {
+	d.DynValue.WithNotifier(notifier)
+	return d
+}
+
+// IPNetList is an immutable list of networks, indexed by a prefix trie so that `Contains` takes time proportional to
+// the length of the address, rather than to the number of networks.
+type IPNetList struct {
+	nets []*net.IPNet
+	v4   *ipTrieNode
+	v6   *ipTrieNode
+}
+
+// NewIPNetList creates an `IPNetList` of the networks. Their addresses are masked, e.g. `10.1.2.3/8` becomes
+// `10.0.0.0/8`, and networks of IPv4-mapped IPv6 addresses are converted to IPv4, e.g. `::ffff:10.0.0.0/104` becomes
+// `10.0.0.0/8`, so that they contain the IPv4 addresses they map.
+func NewIPNetList(nets []*net.IPNet) *IPNetList {
+	l := &IPNetList{nets: make([]*net.IPNet, 0, len(nets)), v4: &ipTrieNode{}, v6: &ipTrieNode{}}
+	for _, n := range nets {
+		masked := &net.IPNet{IP: n.IP.Mask(n.Mask), Mask: n.Mask}
+		if ip4 := masked.IP.To4(); ip4 != nil {
+			// a masked IPv4-mapped address keeps its 0xffff prefix only if at least 96 bits are masked
+			masked.IP = ip4
+			if len(masked.Mask) == net.IPv6len {
+				masked.Mask = append(net.IPMask(nil), masked.Mask[net.IPv6len-net.IPv4len:]...)
+			}
+		}
+		l.nets = append(l.nets, masked)
+		ones, _ := masked.Mask.Size()
+		if len(masked.IP) == net.IPv4len {
+			l.v4.insert(masked.IP, ones)
+		} else {
+			l.v6.insert(masked.IP, ones)
+		}
+	}
+	return l
+}
+
+// Contains returns whether the IP address is in any of the networks.
+func (l *IPNetList) Contains(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		return l.v4.contains(ip4)
+	}
+	if ip16 := ip.To16(); ip16 != nil {
+		return l.v6.contains(ip16)
+	}
+	return false
+}
+
+// View returns a read-only view of the networks, in the order they were given. The view hands out copies of the
+// networks, so modifying them doesn't change the list.
+func (l *IPNetList) View() SliceView[*net.IPNet] {
+	return SliceView[*net.IPNet]{items: l.nets, clone: cloneIPNet}
+}
+
+func cloneIPNet(n *net.IPNet) *net.IPNet {
+	return &net.IPNet{IP: append(net.IP(nil), n.IP...), Mask: append(net.IPMask(nil), n.Mask...)}
+}
+
+// ipTrieNode is a node of a binary trie of network prefixes, `terminal` nodes end a prefix of a network.
+type ipTrieNode struct {
+	children [2]*ipTrieNode
+	terminal bool
+}
+
+func ipBit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+func (n *ipTrieNode) insert(ip net.IP, ones int) {
+	for i := 0; i < ones; i++ {
+		if n.terminal {
+			// a shorter prefix already covers the network
+			return
+		}
+		bit := ipBit(ip, i)
+		if n.children[bit] == nil {
+			n.children[bit] = &ipTrieNode{}
+		}
+		n = n.children[bit]
+	}
+	n.terminal = true
+}
+
+func (n *ipTrieNode) contains(ip net.IP) bool {
+	for i := 0; n != nil; i++ {
+		if n.terminal {
+			return true
+		}
+		if i == len(ip)*8 {
+			return false
+		}
+		n = n.children[ipBit(ip, i)]
+	}
+	return false
+}
+
+type ipNetListCodec struct{}
+
+func (ipNetListCodec) Parse(input string) (*IPNetList, error) {
+	if strings.TrimSpace(input) == "" {
+		return NewIPNetList(nil), nil
+	}
+	items, err := csv.NewReader(strings.NewReader(input)).Read()
+	if err != nil {
+		return nil, err
+	}
+	nets := make([]*net.IPNet, 0, len(items))
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is neither a CIDR network nor an IP address", item)
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return NewIPNetList(nets), nil
+}
+
+func (ipNetListCodec) Format(value *IPNetList) string {
+	items := make([]string, 0, len(value.nets))
+	for _, n := range value.nets {
+		items = append(items, n.String())
+	}
+	return strings.Join(items, ",")
+}
+
+// Canonical sorts the networks and drops duplicates, since their order doesn't change which addresses they contain.
+func (ipNetListCodec) Canonical(value *IPNetList) string {
+	nets := append([]*net.IPNet(nil), value.nets...)
+	sort.Slice(nets, func(i, j int) bool {
+		if len(nets[i].IP) != len(nets[j].IP) {
+			return len(nets[i].IP) < len(nets[j].IP)
+		}
+		if c := bytes.Compare(nets[i].IP, nets[j].IP); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(nets[i].Mask, nets[j].Mask) < 0
+	})
+	items := make([]string, 0, len(nets))
+	for _, n := range nets {
+		if s := n.String(); len(items) == 0 || items[len(items)-1] != s {
+			items = append(items, s)
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+func (ipNetListCodec) Type() string {
+	return "dyn_ipnetlist"
+}
+
+// DynURL creates a `Flag` that represents an absolute `*url.URL`, e.g. of an upstream endpoint, which is safe to
+// change dynamically at runtime. URLs without a scheme or host are rejected, and an empty value sets the flag to nil.
+//
+// The default `value` is normalized like the values passed to `Set`, and it panics if the default would be rejected.
+func DynURL(flagSet *flag.FlagSet, name string, value *url.URL, usage string) *DynURLValue {
+	codec := &urlCodec{}
+	if value != nil {
+		normalized, err := codec.Parse(value.String())
+		if err != nil {
+			panic(fmt.Sprintf("flagz: default of DynURL %v: %v", name, err))
+		}
+		value = normalized
+	}
+	dynValue := &DynURLValue{NewDynValue[*url.URL](flagSet, name, value, codec), codec}
+	flag := flagSet.VarPF(dynValue, name, "", usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynURLValue is a flag-related `*url.URL` value wrapper.
+// The URL returned by `Get` is shared by all readers of the flag and must not be modified.
+type DynURLValue struct {
+	*DynValue[*url.URL]
+	codec *urlCodec
+}
+
+// WithAllowedSchemes rejects URLs with schemes other than `schemes`, e.g. `https`. It applies to values set after
+// the call.
+func (d *DynURLValue) WithAllowedSchemes(schemes ...string) *DynURLValue {
+	allowed := make([]string, 0, len(schemes))
+	for _, s := range schemes {
+		allowed = append(allowed, strings.ToLower(s))
+	}
+	d.codec.allowedSchemes.Store(&allowed)
+	return d
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynURLValue) WithValidator(validator func(*url.URL) error) *DynURLValue {
+	d.DynValue.WithValidator(validator)
+	return d
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine.
+func (d *DynURLValue) WithNotifier(notifier func(oldValue *url.URL, newValue *url.URL)) *DynURLValue {
+	d.DynValue.WithNotifier(notifier)
+	return d
+}
+
+type urlCodec struct {
+	allowedSchemes atomic.Pointer[[]string]
+}
+
+func (c *urlCodec) Parse(input string) (*url.URL, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("url %q must have a scheme and a host", input)
+	}
+	if allowed := c.allowedSchemes.Load(); allowed != nil {
+		ok := false
+		for _, s := range *allowed {
+			ok = ok || s == u.Scheme
+		}
+		if !ok {
+			return nil, fmt.Errorf("url %q must have one of the schemes %v", input, *allowed)
+		}
+	}
+	// host names are case-insensitive, lowering them makes the string representation canonical
+	u.Host = strings.ToLower(u.Host)
+	return u, nil
+}
+
+func (c *urlCodec) Format(value *url.URL) string {
+	if value == nil {
+		return ""
+	}
+	return value.String()
+}
+
+func (c *urlCodec) Type() string {
+	return "dyn_url"
+}
+
+// DynHostPort creates a `Flag` that represents a network address made of a host and a port, e.g. `localhost:8080`,
+// `[::1]:8080` or `:8080`, which is safe to change dynamically at runtime. Ports must be numeric.
+// It panics if the default `value` is not a valid address.
+func DynHostPort(flagSet *flag.FlagSet, name string, value string, usage string) *DynHostPortValue {
+	hostPort, err := parseHostPort(value)
+	if err != nil {
+		panic(fmt.Sprintf("flagz: default of DynHostPort %v: %v", name, err))
+	}
+	dynValue := &DynHostPortValue{NewDynValue[HostPort](flagSet, name, hostPort, hostPortCodec{})}
+	flag := flagSet.VarPF(dynValue, name, "", usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynHostPortValue is a flag-related `HostPort` value wrapper.
+type DynHostPortValue struct {
+	*DynValue[HostPort]
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynHostPortValue) WithValidator(validator func(HostPort) error) *DynHostPortValue {
+	d.DynValue.WithValidator(validator)
+	return d
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine.
+func (d *DynHostPortValue) WithNotifier(notifier func(oldValue HostPort, newValue HostPort)) *DynHostPortValue {
+	d.DynValue.WithNotifier(notifier)
+	return d
+}
+
+// HostPort is a network address made of a host and a port, see `DynHostPort`.
+type HostPort struct {
+	// Host is a host name in lower case or an IP address, and may be empty.
+	Host string
+	Port uint16
+}
+
+// String returns the address as accepted by `net.Dial`, e.g. `[::1]:8080`.
+func (h HostPort) String() string {
+	return net.JoinHostPort(h.Host, strconv.Itoa(int(h.Port)))
+}
+
+func parseHostPort(input string) (HostPort, error) {
+	host, port, err := net.SplitHostPort(strings.TrimSpace(input))
+	if err != nil {
+		return HostPort{}, err
+	}
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || portNumber == 0 {
+		return HostPort{}, fmt.Errorf("port %q of address %q must be a number between 1 and 65535", port, input)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		host = ip.String()
+	}
+	return HostPort{Host: strings.ToLower(host), Port: uint16(portNumber)}, nil
+}
+
+type hostPortCodec struct{}
+
+func (hostPortCodec) Parse(input string) (HostPort, error) {
+	return parseHostPort(input)
+}
+
+func (hostPortCodec) Format(value HostPort) string {
+	return value.String()
+}
+
+func (hostPortCodec) Type() string {
+	return "dyn_hostport"
+}
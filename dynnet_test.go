@@ -0,0 +1,220 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseCIDR(t *testing.T, cidr string) *net.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	require.NoError(t, err)
+	return n
+}
+
+func TestDynIPNetList_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynIPNetList(set, "some_ipnetlist_1", []*net.IPNet{mustParseCIDR(t, "10.0.0.0/8")}, "Use it or lose it")
+	assert.Equal(t, "10.0.0.0/8", dynFlag.String(), "value must be default after create")
+	assert.True(t, dynFlag.Contains(net.ParseIP("10.1.2.3")))
+	assert.False(t, dynFlag.Contains(net.ParseIP("11.1.2.3")))
+
+	require.NoError(t, set.Set("some_ipnetlist_1", "192.168.1.7/24, 2001:db8::/32,172.16.0.1"), "setting value must succeed")
+	assert.Equal(t, "192.168.1.0/24,2001:db8::/32,172.16.0.1/32", dynFlag.String(), "networks must be masked")
+	assert.Equal(t, 3, dynFlag.View().Len())
+	assert.False(t, dynFlag.Contains(net.ParseIP("10.1.2.3")), "value must be set after update")
+
+	assert.Error(t, set.Set("some_ipnetlist_1", "10.0.0.0/33"), "invalid networks must be rejected")
+	assert.Error(t, set.Set("some_ipnetlist_1", "10.0.0.0/8,not-an-ip"), "invalid addresses must be rejected")
+	assert.Equal(t, 3, dynFlag.View().Len(), "value must not change after a bad update")
+
+	require.NoError(t, set.Set("some_ipnetlist_1", ""))
+	assert.Equal(t, 0, dynFlag.View().Len())
+	assert.False(t, dynFlag.Contains(net.ParseIP("10.1.2.3")), "empty list must not contain anything")
+}
+
+func TestDynIPNetList_Contains(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynIPNetList(set, "some_ipnetlist_1", nil, "Use it or lose it")
+	require.NoError(t, set.Set("some_ipnetlist_1", "10.0.0.0/8,10.1.0.0/16,192.168.1.128/25,2001:db8::/32,::1,0.0.0.0/32"))
+
+	for ip, contained := range map[string]bool{
+		"10.0.0.0":        true,
+		"10.255.255.255":  true,
+		"11.0.0.0":        false,
+		"192.168.1.128":   true,
+		"192.168.1.255":   true,
+		"192.168.1.127":   false,
+		"::ffff:10.2.3.4": true,
+		"2001:db8::1":     true,
+		"2001:db9::1":     false,
+		"::1":             true,
+		"::2":             false,
+		"0.0.0.0":         true,
+		"0.0.0.1":         false,
+	} {
+		assert.Equal(t, contained, dynFlag.Contains(net.ParseIP(ip)), "Contains(%v)", ip)
+	}
+	assert.False(t, dynFlag.Contains(nil), "invalid addresses must not be contained")
+}
+
+func TestDynIPNetList_ContainsIPv4MappedNetworks(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynIPNetList(set, "some_ipnetlist_1", nil, "Use it or lose it")
+	require.NoError(t, set.Set("some_ipnetlist_1", "::ffff:10.0.0.0/104,::ffff:192.168.1.1,::ffff:0:0/96"))
+	assert.Equal(t, "10.0.0.0/8,192.168.1.1/32,0.0.0.0/0", dynFlag.String(), "IPv4-mapped networks must be converted to IPv4")
+
+	require.NoError(t, set.Set("some_ipnetlist_1", "::ffff:10.0.0.0/104"))
+	for ip, contained := range map[string]bool{
+		"10.1.2.3":        true,
+		"::ffff:10.1.2.3": true,
+		"11.1.2.3":        false,
+		"::10.1.2.3":      false,
+	} {
+		assert.Equal(t, contained, dynFlag.Contains(net.ParseIP(ip)), "Contains(%v)", ip)
+	}
+}
+
+func TestDynIPNetList_ContainsEverything(t *testing.T) {
+	list := NewIPNetList([]*net.IPNet{mustParseCIDR(t, "0.0.0.0/0")})
+	assert.True(t, list.Contains(net.ParseIP("1.2.3.4")))
+	assert.False(t, list.Contains(net.ParseIP("2001:db8::1")), "IPv4 networks must not contain IPv6 addresses")
+}
+
+func TestDynIPNetList_CanonicalString(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynIPNetList(set, "some_ipnetlist_1", nil, "Use it or lose it")
+	require.NoError(t, set.Set("some_ipnetlist_1", "2001:db8::/32,10.1.2.3/8,10.0.0.0/8,1.2.3.4"))
+	assert.Equal(t, "2001:db8::/32,10.0.0.0/8,10.0.0.0/8,1.2.3.4/32", dynFlag.String())
+	assert.Equal(t, "1.2.3.4/32,10.0.0.0/8,2001:db8::/32", dynFlag.CanonicalString(), "canonical value must be sorted and deduplicated")
+}
+
+func TestDynIPNetList_FiresValidators(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynIPNetList(set, "some_ipnetlist_1", nil, "Use it or lose it").WithValidator(func(l *IPNetList) error {
+		if l.Contains(net.ParseIP("127.0.0.1")) {
+			return fmt.Errorf("loopback must never be allowed")
+		}
+		return nil
+	})
+
+	assert.NoError(t, set.Set("some_ipnetlist_1", "10.0.0.0/8"), "no error from validator when allowed")
+	assert.Error(t, set.Set("some_ipnetlist_1", "127.0.0.0/8"), "error from validator when not allowed")
+}
+
+func TestDynIPNetList_IsMarkedDynamic(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynIPNetList(set, "some_ipnetlist_1", nil, "Use it or lose it")
+	assert.True(t, IsFlagDynamic(set.Lookup("some_ipnetlist_1")))
+}
+
+func TestDynURL_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	def, _ := url.Parse("http://localhost:8080/api")
+	dynFlag := DynURL(set, "some_url_1", def, "Use it or lose it")
+	assert.Equal(t, "http://localhost:8080/api", dynFlag.String(), "value must be default after create")
+
+	require.NoError(t, set.Set("some_url_1", "HTTPS://Upstream.Example.com/v1?q=1"), "setting value must succeed")
+	assert.Equal(t, "https", dynFlag.Get().Scheme)
+	assert.Equal(t, "upstream.example.com", dynFlag.Get().Host, "host must be lowered")
+	assert.Equal(t, "https://upstream.example.com/v1?q=1", dynFlag.CanonicalString())
+
+	assert.Error(t, set.Set("some_url_1", "/relative/path"), "urls without a scheme and host must be rejected")
+	assert.Error(t, set.Set("some_url_1", "http://[::1"), "invalid urls must be rejected")
+	assert.Equal(t, "https://upstream.example.com/v1?q=1", dynFlag.String(), "value must not change after a bad update")
+
+	require.NoError(t, set.Set("some_url_1", ""))
+	assert.Nil(t, dynFlag.Get(), "empty value must set the url to nil")
+	assert.Equal(t, "", dynFlag.String())
+}
+
+func TestDynURL_NormalizesDefault(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	def, _ := url.Parse("HTTP://LocalHost:8080/api")
+	dynFlag := DynURL(set, "some_url_1", def, "Use it or lose it")
+	assert.Equal(t, "localhost:8080", dynFlag.Get().Host, "default must be normalized like set values")
+	assert.Equal(t, "localhost:8080", dynFlag.Default().Host)
+	assert.NotSame(t, def, dynFlag.Get(), "default must not be shared with the caller")
+
+	relative, _ := url.Parse("/relative/path")
+	assert.Panics(t, func() {
+		DynURL(set, "some_url_2", relative, "Use it or lose it")
+	}, "defaults that would be rejected must panic")
+}
+
+func TestDynURL_WithAllowedSchemes(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynURL(set, "some_url_1", nil, "Use it or lose it").WithAllowedSchemes("HTTPS", "grpc")
+	assert.NoError(t, set.Set("some_url_1", "https://example.com"))
+	assert.NoError(t, set.Set("some_url_1", "grpc://example.com:443"))
+	assert.Error(t, set.Set("some_url_1", "http://example.com"), "schemes that are not allowed must be rejected")
+	assert.Equal(t, "grpc://example.com:443", dynFlag.String())
+}
+
+func TestDynURL_FiresNotifier(t *testing.T) {
+	waitCh := make(chan bool, 1)
+	notifier := func(oldVal *url.URL, newVal *url.URL) {
+		assert.Nil(t, oldVal, "old value in notify must match previous value")
+		assert.Equal(t, "https://example.com", newVal.String(), "new value in notify must match set value")
+		waitCh <- true
+	}
+
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynURL(set, "some_url_1", nil, "Use it or lose it").WithNotifier(notifier)
+	set.Set("some_url_1", "https://example.com")
+	select {
+	case <-time.After(5 * time.Millisecond):
+		assert.Fail(t, "failed to trigger notifier")
+	case <-waitCh:
+	}
+}
+
+func TestDynHostPort_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynHostPort(set, "some_hostport_1", "localhost:8080", "Use it or lose it")
+	assert.Equal(t, HostPort{Host: "localhost", Port: 8080}, dynFlag.Get(), "value must be default after create")
+
+	require.NoError(t, set.Set("some_hostport_1", "Upstream.Example.com:443"), "setting value must succeed")
+	assert.Equal(t, HostPort{Host: "upstream.example.com", Port: 443}, dynFlag.Get())
+	assert.Equal(t, "upstream.example.com:443", dynFlag.CanonicalString())
+
+	require.NoError(t, set.Set("some_hostport_1", "[::0001]:53"))
+	assert.Equal(t, "[::1]:53", dynFlag.String(), "IPv6 addresses must be canonical")
+
+	require.NoError(t, set.Set("some_hostport_1", ":9090"))
+	assert.Equal(t, HostPort{Port: 9090}, dynFlag.Get(), "host may be empty")
+
+	for _, bad := range []string{"localhost", "localhost:0", "localhost:65536", "localhost:http", "::1:53"} {
+		assert.Error(t, set.Set("some_hostport_1", bad), "%q must be rejected", bad)
+	}
+	assert.Equal(t, ":9090", dynFlag.String(), "value must not change after a bad update")
+}
+
+func TestDynHostPort_PanicsOnBadDefault(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	assert.Panics(t, func() {
+		DynHostPort(set, "some_hostport_1", "localhost", "Use it or lose it")
+	})
+}
+
+func TestDynHostPort_FiresValidators(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynHostPort(set, "some_hostport_1", ":8080", "Use it or lose it").WithValidator(func(h HostPort) error {
+		if h.Port < 1024 {
+			return fmt.Errorf("privileged ports are not allowed")
+		}
+		return nil
+	})
+
+	assert.NoError(t, set.Set("some_hostport_1", ":8081"), "no error from validator when allowed")
+	assert.Error(t, set.Set("some_hostport_1", ":80"), "error from validator when not allowed")
+}
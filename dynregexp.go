@@ -0,0 +1,198 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"sync/atomic"
+
+	flag "github.com/spf13/pflag"
+)
+
+// DynRegexp creates a `Flag` that represents a compiled `*regexp.Regexp` which is safe to change dynamically at
+// runtime. Patterns are compiled once when they are set, and invalid ones are rejected, so `Get` returns a regexp
+// that is ready to use. An empty pattern sets the flag to nil, e.g. to disable matching.
+func DynRegexp(flagSet *flag.FlagSet, name string, value *regexp.Regexp, usage string) *DynRegexpValue {
+	codec := &regexpCodec{}
+	dynValue := &DynRegexpValue{NewDynValue[*regexp.Regexp](flagSet, name, value, codec), codec}
+	flag := flagSet.VarPF(dynValue, name, "", usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynRegexpValue is a flag-related `*regexp.Regexp` value wrapper.
+type DynRegexpValue struct {
+	*DynValue[*regexp.Regexp]
+	codec *regexpCodec
+}
+
+// MatchString reports whether the current regexp matches `s`. It returns false if the flag is nil.
+func (d *DynRegexpValue) MatchString(s string) bool {
+	re := d.Get()
+	return re != nil && re.MatchString(s)
+}
+
+// WithMaxProgramSize rejects patterns that compile to RE2 programs of more than `size` instructions, which bounds
+// the cost of matching. It applies to values set after the call.
+func (d *DynRegexpValue) WithMaxProgramSize(size int) *DynRegexpValue {
+	d.codec.maxProgramSize.Store(int64(size))
+	return d
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynRegexpValue) WithValidator(validator func(*regexp.Regexp) error) *DynRegexpValue {
+	d.DynValue.WithValidator(validator)
+	return d
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine.
+func (d *DynRegexpValue) WithNotifier(notifier func(oldValue *regexp.Regexp, newValue *regexp.Regexp)) *DynRegexpValue {
+	d.DynValue.WithNotifier(notifier)
+	return d
+}
+
+// DynRegexpList creates a `Flag` that represents a list of compiled `*regexp.Regexp` which is safe to change
+// dynamically at runtime. Like `DynStringSlice`, the patterns are comma-separated, and patterns containing commas,
+// e.g. `a{1,3}`, must be quoted as in CSV: `"a{1,3}",b`.
+func DynRegexpList(flagSet *flag.FlagSet, name string, value []*regexp.Regexp, usage string) *DynRegexpListValue {
+	codec := &regexpListCodec{}
+	value = append([]*regexp.Regexp(nil), value...)
+	dynValue := &DynRegexpListValue{NewDynValue[[]*regexp.Regexp](flagSet, name, value, codec), codec}
+	flag := flagSet.VarPF(dynValue, name, "", usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynRegexpListValue is a flag-related `[]*regexp.Regexp` value wrapper.
+//
+// The slice returned by `Get` is shared by all readers of the flag and must not be modified, use `View` to read it
+// safely, or `View().Copy()` to get a slice the caller owns. The regexps themselves are shared either way, and are
+// safe for concurrent use as long as `Longest` isn't called on them.
+type DynRegexpListValue struct {
+	*DynValue[[]*regexp.Regexp]
+	codec *regexpListCodec
+}
+
+// View returns a read-only view of the current value.
+func (d *DynRegexpListValue) View() SliceView[*regexp.Regexp] {
+	return SliceView[*regexp.Regexp]{items: d.Get()}
+}
+
+// MatchString reports whether any of the current regexps matches `s`.
+func (d *DynRegexpListValue) MatchString(s string) bool {
+	for _, re := range d.Get() {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithMaxProgramSize rejects lists with any pattern that compiles to an RE2 program of more than `size`
+// instructions, which bounds the cost of matching. It applies to values set after the call.
+func (d *DynRegexpListValue) WithMaxProgramSize(size int) *DynRegexpListValue {
+	d.codec.maxProgramSize.Store(int64(size))
+	return d
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynRegexpListValue) WithValidator(validator func([]*regexp.Regexp) error) *DynRegexpListValue {
+	d.DynValue.WithValidator(validator)
+	return d
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine.
+func (d *DynRegexpListValue) WithNotifier(notifier func(oldValue []*regexp.Regexp, newValue []*regexp.Regexp)) *DynRegexpListValue {
+	d.DynValue.WithNotifier(notifier)
+	return d
+}
+
+// compileRegexp compiles the pattern, rejecting it if its RE2 program is larger than `maxProgramSize`, unless that's 0.
+func compileRegexp(pattern string, maxProgramSize int64) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if maxProgramSize > 0 {
+		parsed, err := syntax.Parse(pattern, syntax.Perl)
+		if err != nil {
+			return nil, err
+		}
+		prog, err := syntax.Compile(parsed.Simplify())
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(prog.Inst)) > maxProgramSize {
+			return nil, fmt.Errorf("pattern %q compiles to %d instructions, more than the limit of %d", pattern, len(prog.Inst), maxProgramSize)
+		}
+	}
+	return re, nil
+}
+
+type regexpCodec struct {
+	maxProgramSize atomic.Int64
+}
+
+func (c *regexpCodec) Parse(input string) (*regexp.Regexp, error) {
+	if input == "" {
+		return nil, nil
+	}
+	return compileRegexp(input, c.maxProgramSize.Load())
+}
+
+func (c *regexpCodec) Format(value *regexp.Regexp) string {
+	if value == nil {
+		return ""
+	}
+	return value.String()
+}
+
+func (c *regexpCodec) Type() string {
+	return "dyn_regexp"
+}
+
+type regexpListCodec struct {
+	maxProgramSize atomic.Int64
+}
+
+func (c *regexpListCodec) Parse(input string) ([]*regexp.Regexp, error) {
+	if strings.TrimSpace(input) == "" {
+		return []*regexp.Regexp{}, nil
+	}
+	patterns, err := csv.NewReader(strings.NewReader(input)).Read()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := compileRegexp(pattern, c.maxProgramSize.Load())
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, re)
+	}
+	return ret, nil
+}
+
+func (c *regexpListCodec) Format(value []*regexp.Regexp) string {
+	patterns := make([]string, 0, len(value))
+	for _, re := range value {
+		patterns = append(patterns, re.String())
+	}
+	return formatCSV(patterns)
+}
+
+func (c *regexpListCodec) Type() string {
+	return "dyn_regexplist"
+}
@@ -0,0 +1,114 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynRegexp_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynRegexp(set, "some_regexp_1", regexp.MustCompile(`^/api/`), "Use it or lose it")
+	assert.Equal(t, `^/api/`, dynFlag.Get().String(), "value must be default after create")
+	assert.True(t, dynFlag.MatchString("/api/foo"))
+
+	require.NoError(t, set.Set("some_regexp_1", `^/(debug|metrics)/`), "setting value must succeed")
+	assert.True(t, dynFlag.MatchString("/metrics/foo"), "value must be set after update")
+	compiled := dynFlag.Get()
+	assert.Same(t, compiled, dynFlag.Get(), "the regexp must be compiled once on set")
+
+	assert.Error(t, set.Set("some_regexp_1", `^/(debug`), "invalid patterns must be rejected")
+	assert.Same(t, compiled, dynFlag.Get(), "value must not change after a bad update")
+}
+
+func TestDynRegexp_EmptyPatternIsNil(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynRegexp(set, "some_regexp_1", regexp.MustCompile(`^/api/`), "Use it or lose it")
+	require.NoError(t, set.Set("some_regexp_1", ""))
+	assert.Nil(t, dynFlag.Get())
+	assert.False(t, dynFlag.MatchString("/api/foo"), "nil regexp must not match anything")
+	assert.Equal(t, "", dynFlag.String())
+}
+
+func TestDynRegexp_MaxProgramSize(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynRegexp(set, "some_regexp_1", nil, "Use it or lose it").WithMaxProgramSize(50)
+	assert.NoError(t, set.Set("some_regexp_1", `^/api/v[0-9]+/`), "small patterns must be accepted")
+	err := set.Set("some_regexp_1", `(a{1,100}b{1,100})+`)
+	require.Error(t, err, "large patterns must be rejected")
+	assert.Contains(t, err.Error(), "more than the limit of 50")
+}
+
+func TestDynRegexp_IsMarkedDynamic(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynRegexp(set, "some_regexp_1", nil, "Use it or lose it")
+	assert.True(t, IsFlagDynamic(set.Lookup("some_regexp_1")))
+}
+
+func TestDynRegexp_FiresValidators(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynRegexp(set, "some_regexp_1", nil, "Use it or lose it").WithValidator(func(re *regexp.Regexp) error {
+		if re != nil && re.MatchString("/healthz") {
+			return fmt.Errorf("health checks must never be shed")
+		}
+		return nil
+	})
+
+	assert.NoError(t, set.Set("some_regexp_1", `^/api/`), "no error from validator when allowed")
+	assert.Error(t, set.Set("some_regexp_1", `.*`), "error from validator when not allowed")
+}
+
+func TestDynRegexp_FiresNotifier(t *testing.T) {
+	waitCh := make(chan bool, 1)
+	notifier := func(oldVal *regexp.Regexp, newVal *regexp.Regexp) {
+		assert.Nil(t, oldVal, "old value in notify must match previous value")
+		assert.Equal(t, `^/api/`, newVal.String(), "new value in notify must match set value")
+		waitCh <- true
+	}
+
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynRegexp(set, "some_regexp_1", nil, "Use it or lose it").WithNotifier(notifier)
+	set.Set("some_regexp_1", `^/api/`)
+	select {
+	case <-time.After(5 * time.Millisecond):
+		assert.Fail(t, "failed to trigger notifier")
+	case <-waitCh:
+	}
+}
+
+func TestDynRegexpList_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynRegexpList(set, "some_regexplist_1", []*regexp.Regexp{regexp.MustCompile(`^/api/`)}, "Use it or lose it")
+	assert.True(t, dynFlag.MatchString("/api/foo"))
+	assert.False(t, dynFlag.MatchString("/debug/foo"))
+
+	require.NoError(t, set.Set("some_regexplist_1", `^/debug/,"^/v[0-9]{1,3}/"`), "setting value must succeed")
+	view := dynFlag.View()
+	require.Equal(t, 2, view.Len())
+	assert.Equal(t, `^/v[0-9]{1,3}/`, view.At(1).String(), "quoted patterns may contain commas")
+	assert.True(t, dynFlag.MatchString("/v12/foo"))
+	assert.False(t, dynFlag.MatchString("/api/foo"))
+	assert.Equal(t, `^/debug/,"^/v[0-9]{1,3}/"`, dynFlag.String(), "value must be formatted so it can be parsed back")
+
+	assert.Error(t, set.Set("some_regexplist_1", `^/api/,^/(debug`), "lists with an invalid pattern must be rejected")
+	assert.Equal(t, 2, dynFlag.View().Len(), "value must not change after a bad update")
+
+	require.NoError(t, set.Set("some_regexplist_1", ""))
+	assert.Equal(t, 0, dynFlag.View().Len())
+	assert.False(t, dynFlag.MatchString("/api/foo"), "empty list must not match anything")
+}
+
+func TestDynRegexpList_MaxProgramSize(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynRegexpList(set, "some_regexplist_1", nil, "Use it or lose it").WithMaxProgramSize(50)
+	assert.NoError(t, set.Set("some_regexplist_1", `^/api/,^/debug/`), "small patterns must be accepted")
+	assert.Error(t, set.Set("some_regexplist_1", `^/api/,(a{1,100}b{1,100})+`), "lists with a large pattern must be rejected")
+}
@@ -0,0 +1,195 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	flag "github.com/spf13/pflag"
+)
+
+// rolloutBuckets is the number of buckets keys are hashed into, allowing percentages with two decimal places.
+const rolloutBuckets = 10000
+
+// Rollout is a set of rules that decides whether a feature is enabled for a given key, e.g. a user ID.
+//
+// Rules are evaluated in order: keys in `Deny` are disabled, keys in `Allow` are enabled, keys whose attributes don't
+// match `Attributes` are disabled, and the remaining ones are enabled for `Percentage` percent of keys.
+type Rollout struct {
+	// Percentage of keys, from 0 to 100, for which the feature is enabled.
+	Percentage float64 `json:"percentage"`
+	// Allow lists keys for which the feature is always enabled.
+	Allow []string `json:"allow,omitempty"`
+	// Deny lists keys for which the feature is always disabled.
+	Deny []string `json:"deny,omitempty"`
+	// Attributes maps attribute names to their accepted values. Keys must match all of them to be considered.
+	Attributes map[string][]string `json:"attributes,omitempty"`
+	// Seed changes how keys are assigned to buckets. It defaults to the flag name, so that separate rollouts enable
+	// the feature for different keys.
+	Seed string `json:"seed,omitempty"`
+
+	allow      map[string]struct{}
+	deny       map[string]struct{}
+	attributes map[string]map[string]struct{}
+	compiled   bool
+}
+
+// Enabled returns whether the feature is enabled for the `key` with the given `attrs`.
+//
+// Keys are assigned to buckets with a stable hash, so a key for which the feature is enabled stays enabled as the
+// `Percentage` grows.
+func (r *Rollout) Enabled(key string, attrs map[string]string) bool {
+	if !r.compiled {
+		return r.enabledUncompiled(key, attrs)
+	}
+	if _, ok := r.deny[key]; ok {
+		return false
+	}
+	if _, ok := r.allow[key]; ok {
+		return true
+	}
+	for name, accepted := range r.attributes {
+		if _, ok := accepted[attrs[name]]; !ok {
+			return false
+		}
+	}
+	return float64(rolloutBucket(r.Seed, key)) < r.Percentage*rolloutBuckets/100
+}
+
+// enabledUncompiled evaluates the rules of a `Rollout` built as a literal rather than parsed by the flag, scanning
+// its slices instead of the lookup sets.
+func (r *Rollout) enabledUncompiled(key string, attrs map[string]string) bool {
+	if containsString(r.Deny, key) {
+		return false
+	}
+	if containsString(r.Allow, key) {
+		return true
+	}
+	for name, accepted := range r.Attributes {
+		if !containsString(accepted, attrs[name]) {
+			return false
+		}
+	}
+	return float64(rolloutBucket(r.Seed, key)) < r.Percentage*rolloutBuckets/100
+}
+
+func containsString(items []string, item string) bool {
+	for _, candidate := range items {
+		if candidate == item {
+			return true
+		}
+	}
+	return false
+}
+
+func rolloutBucket(seed string, key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(seed))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return h.Sum64() % rolloutBuckets
+}
+
+// DynRollout creates a `Flag` that represents a `Rollout` which is safe to change dynamically at runtime.
+// The value of the flag is the JSON representation of the `Rollout`, e.g. `{"percentage": 5, "deny": ["user1"]}`.
+// It panics if the default `value` is nil or has a percentage out of range, which `Set` would reject.
+func DynRollout(flagSet *flag.FlagSet, name string, value *Rollout, usage string) *DynRolloutValue {
+	if value == nil {
+		panic(fmt.Sprintf("flagz: default of DynRollout %v must not be nil", name))
+	}
+	if err := validateRollout(value); err != nil {
+		panic(fmt.Sprintf("flagz: default of DynRollout %v: %v", name, err))
+	}
+	codec := &rolloutCodec{defaultSeed: name}
+	dynValue := &DynRolloutValue{NewDynValue[*Rollout](flagSet, name, codec.compile(*value), codec)}
+	flag := flagSet.VarPF(dynValue, name, "", usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynRolloutValue is a flag-related `Rollout` value wrapper.
+type DynRolloutValue struct {
+	*DynValue[*Rollout]
+}
+
+// Enabled returns whether the feature is enabled for the `key` with the given `attrs`, see `Rollout.Enabled`.
+func (d *DynRolloutValue) Enabled(key string, attrs map[string]string) bool {
+	return d.Get().Enabled(key, attrs)
+}
+
+// EnabledCtx is like `Enabled`, but takes into account overrides carried by `ctx`, see `WithOverrides`.
+func (d *DynRolloutValue) EnabledCtx(ctx context.Context, key string, attrs map[string]string) bool {
+	return d.GetCtx(ctx).Enabled(key, attrs)
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynRolloutValue) WithValidator(validator func(*Rollout) error) *DynRolloutValue {
+	d.DynValue.WithValidator(validator)
+	return d
+}
+
+// WithNotifier adds a function that is called every time a new value is successfully set.
+// Each notifier is executed asynchronously in a new go-routine.
+func (d *DynRolloutValue) WithNotifier(notifier func(oldValue *Rollout, newValue *Rollout)) *DynRolloutValue {
+	d.DynValue.WithNotifier(notifier)
+	return d
+}
+
+type rolloutCodec struct {
+	defaultSeed string
+}
+
+func (c *rolloutCodec) Parse(input string) (*Rollout, error) {
+	r := Rollout{}
+	if err := json.Unmarshal([]byte(input), &r); err != nil {
+		return nil, err
+	}
+	if err := validateRollout(&r); err != nil {
+		return nil, err
+	}
+	return c.compile(r), nil
+}
+
+func validateRollout(r *Rollout) error {
+	if !(r.Percentage >= 0 && r.Percentage <= 100) {
+		return fmt.Errorf("rollout percentage %v is not in [0, 100] range", r.Percentage)
+	}
+	return nil
+}
+
+// compile returns a copy of the rollout with lookup sets built for its rules.
+func (c *rolloutCodec) compile(r Rollout) *Rollout {
+	if r.Seed == "" {
+		r.Seed = c.defaultSeed
+	}
+	r.allow = buildStringSet(r.Allow)
+	r.deny = buildStringSet(r.Deny)
+	r.attributes = make(map[string]map[string]struct{}, len(r.Attributes))
+	for name, values := range r.Attributes {
+		r.attributes[name] = buildStringSet(values)
+	}
+	r.compiled = true
+	return &r
+}
+
+func (c *rolloutCodec) Format(value *Rollout) string {
+	out, err := json.Marshal(value)
+	if err != nil {
+		return "ERR"
+	}
+	return string(out)
+}
+
+func (c *rolloutCodec) Canonical(value *Rollout) string {
+	return canonicalJSONOrErr(c.Format(value))
+}
+
+func (c *rolloutCodec) Type() string {
+	return "dyn_rollout"
+}
@@ -0,0 +1,114 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynRollout_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynRollout(set, "some_rollout_1", &Rollout{Percentage: 0}, "Use it or lose it")
+	assert.False(t, dynFlag.Enabled("user1", nil), "nothing must be enabled at 0%")
+
+	require.NoError(t, set.Set("some_rollout_1", `{"percentage": 100, "deny": ["user1"]}`))
+	assert.False(t, dynFlag.Enabled("user1", nil), "denied keys must be disabled")
+	assert.True(t, dynFlag.Enabled("user2", nil), "everything else must be enabled at 100%")
+	assert.Equal(t, "some_rollout_1", dynFlag.Get().Seed, "seed must default to the flag name")
+
+	assert.Error(t, set.Set("some_rollout_1", `{"percentage": 101}`), "percentages above 100 must be rejected")
+	assert.Error(t, set.Set("some_rollout_1", `{"percentage": `), "bad JSON must be rejected")
+}
+
+func TestDynRollout_PanicsOnBadDefault(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	assert.Panics(t, func() {
+		DynRollout(set, "some_rollout_1", &Rollout{Percentage: 150}, "Use it or lose it")
+	}, "percentages above 100 must be rejected")
+	assert.Panics(t, func() {
+		DynRollout(set, "some_rollout_2", &Rollout{Percentage: -1}, "Use it or lose it")
+	}, "negative percentages must be rejected")
+	assert.Panics(t, func() {
+		DynRollout(set, "some_rollout_3", nil, "Use it or lose it")
+	}, "nil defaults must be rejected")
+}
+
+func TestDynRollout_AllowAndAttributes(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynRollout(set, "some_rollout_1", &Rollout{Percentage: 100}, "Use it or lose it")
+	require.NoError(t, set.Set("some_rollout_1",
+		`{"percentage": 100, "allow": ["tester"], "attributes": {"country": ["PL", "UK"]}}`))
+
+	assert.True(t, dynFlag.Enabled("user1", map[string]string{"country": "PL"}))
+	assert.False(t, dynFlag.Enabled("user1", map[string]string{"country": "US"}), "keys with unmatched attributes must be disabled")
+	assert.False(t, dynFlag.Enabled("user1", nil), "keys without attributes must be disabled")
+	assert.True(t, dynFlag.Enabled("tester", nil), "allowed keys must be enabled regardless of attributes")
+}
+
+func TestDynRollout_BucketsAreStableAsPercentageGrows(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynRollout(set, "some_rollout_1", &Rollout{Percentage: 5}, "Use it or lose it")
+
+	enabledAt := func(percentage float64) map[string]bool {
+		require.NoError(t, set.Set("some_rollout_1", fmt.Sprintf(`{"percentage": %v}`, percentage)))
+		enabled := map[string]bool{}
+		for i := 0; i < 10000; i++ {
+			key := fmt.Sprintf("user%d", i)
+			if dynFlag.Enabled(key, nil) {
+				enabled[key] = true
+			}
+		}
+		return enabled
+	}
+	previous := enabledAt(1)
+	for _, percentage := range []float64{5, 20, 50} {
+		current := enabledAt(percentage)
+		for key := range previous {
+			assert.True(t, current[key], "key %v enabled before must stay enabled at %v%%", key, percentage)
+		}
+		assert.InDelta(t, percentage*100, len(current), 150, "the share of enabled keys must follow the percentage")
+		previous = current
+	}
+}
+
+func TestDynRollout_SeedsSeparateRollouts(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	first := DynRollout(set, "some_rollout_1", &Rollout{Percentage: 50}, "Use it or lose it")
+	second := DynRollout(set, "some_rollout_2", &Rollout{Percentage: 50}, "Use it or lose it")
+	differ := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("user%d", i)
+		if first.Enabled(key, nil) != second.Enabled(key, nil) {
+			differ++
+		}
+	}
+	assert.True(t, differ > 300, "rollouts with different seeds must enable the feature for different keys")
+}
+
+func TestDynRollout_EnabledCtx(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynRollout(set, "some_rollout_1", &Rollout{Percentage: 0}, "Use it or lose it")
+	ctx := WithOverrides(context.Background(), map[string]string{"some_rollout_1": `{"percentage": 100}`})
+	assert.True(t, dynFlag.EnabledCtx(ctx, "user1", nil), "overrides must be taken into account")
+	assert.False(t, dynFlag.Enabled("user1", nil))
+}
+
+func TestRollout_EnabledForLiterals(t *testing.T) {
+	rollout := &Rollout{
+		Allow:      []string{"vip"},
+		Deny:       []string{"banned"},
+		Attributes: map[string][]string{"country": {"PL"}},
+		Percentage: 100,
+	}
+	assert.True(t, rollout.Enabled("vip", nil), "allowed keys must be enabled without parsing the rollout")
+	assert.False(t, rollout.Enabled("banned", map[string]string{"country": "PL"}), "denied keys must be disabled")
+	assert.False(t, rollout.Enabled("user1", map[string]string{"country": "DE"}), "attributes must be checked")
+	assert.True(t, rollout.Enabled("user1", map[string]string{"country": "PL"}))
+}
@@ -6,75 +6,38 @@ package flagz
 import (
 	"fmt"
 	"regexp"
-	"sync/atomic"
-	"unsafe"
 
 	flag "github.com/spf13/pflag"
 )
 
 // DynString creates a `Flag` that represents `string` which is safe to change dynamically at runtime.
 func DynString(flagSet *flag.FlagSet, name string, value string, usage string) *DynStringValue {
-	dynValue := &DynStringValue{ptr: unsafe.Pointer(&value)}
+	dynValue := &DynStringValue{NewDynValue[string](flagSet, name, value, stringCodec{})}
 	flag := flagSet.VarPF(dynValue, name, "", usage)
 	MarkFlagDynamic(flag)
 	return dynValue
 }
 
-// DynStringValue is a flag-related `time.Duration` value wrapper.
+// DynStringValue is a flag-related `string` value wrapper.
 type DynStringValue struct {
-	ptr       unsafe.Pointer
-	validator func(string) error
-	notifier  func(oldValue string, newValue string)
-}
-
-// Get retrieves the value in a thread-safe manner.
-func (d *DynStringValue) Get() string {
-	p := (*string)(atomic.LoadPointer(&d.ptr))
-	return *p
-}
-
-// Set updates the value from a string representation in a thread-safe manner.
-// This operation may return an error if the provided `input` doesn't parse, or the resulting value doesn't pass an
-// optional validator.
-// If a notifier is set on the value, it will be invoked in a separate go-routine.
-func (d *DynStringValue) Set(val string) error {
-	if d.validator != nil {
-		if err := d.validator(val); err != nil {
-			return err
-		}
-	}
-	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&val))
-	if d.notifier != nil {
-		go d.notifier(*(*string)(oldPtr), val)
-	}
-	return nil
+	*DynValue[string]
 }
 
 // WithValidator adds a function that checks values before they're set.
 // Any error returned by the validator will lead to the value being rejected.
 // Validators are executed on the same go-routine as the call to `Set`.
 func (d *DynStringValue) WithValidator(validator func(string) error) *DynStringValue {
-	d.validator = validator
+	d.DynValue.WithValidator(validator)
 	return d
 }
 
 // WithNotifier adds a function is called every time a new value is successfully set.
 // Each notifier is executed in a new go-routine.
 func (d *DynStringValue) WithNotifier(notifier func(oldValue string, newValue string)) *DynStringValue {
-	d.notifier = notifier
+	d.DynValue.WithNotifier(notifier)
 	return d
 }
 
-// Type is an indicator of what this flag represents.
-func (d *DynStringValue) Type() string {
-	return "dyn_string"
-}
-
-// String represents the canonical representation of the type.
-func (d *DynStringValue) String() string {
-	return fmt.Sprintf("%v", d.Get())
-}
-
 // ValidateDynStringMatchesRegex returns a validator function that checks all flag's values against regex.
 func ValidateDynStringMatchesRegex(matcher *regexp.Regexp) func(string) error {
 	return func(value string) error {
@@ -84,3 +47,17 @@ func ValidateDynStringMatchesRegex(matcher *regexp.Regexp) func(string) error {
 		return nil
 	}
 }
+
+type stringCodec struct{}
+
+func (stringCodec) Parse(input string) (string, error) {
+	return input, nil
+}
+
+func (stringCodec) Format(value string) string {
+	return fmt.Sprintf("%v", value)
+}
+
+func (stringCodec) Type() string {
+	return "dyn_string"
+}
@@ -6,9 +6,8 @@ package flagz
 import (
 	"encoding/csv"
 	"fmt"
+	"sort"
 	"strings"
-	"sync/atomic"
-	"unsafe"
 
 	flag "github.com/spf13/pflag"
 )
@@ -17,45 +16,23 @@ import (
 // Unlike `pflag.StringSlice`, consecutive sets don't append to the slice, but override it.
 func DynStringSet(flagSet *flag.FlagSet, name string, value []string, usage string) *DynStringSetValue {
 	set := buildStringSet(value)
-	dynValue := &DynStringSetValue{ptr: unsafe.Pointer(&set)}
+	dynValue := &DynStringSetValue{NewDynValue[map[string]struct{}](flagSet, name, set, stringSetCodec{})}
 	flag := flagSet.VarPF(dynValue, name, "", usage)
 	MarkFlagDynamic(flag)
 	return dynValue
 }
 
 // DynStringSetValue is a flag-related `map[string]struct{}` value wrapper.
+//
+// The map returned by `Get` is shared by all readers of the flag and must not be modified, use `View` to read it
+// safely, or `View().Copy()` to get a map the caller owns.
 type DynStringSetValue struct {
-	ptr       unsafe.Pointer
-	validator func(map[string]struct{}) error
-	notifier  func(oldValue map[string]struct{}, newValue map[string]struct{})
+	*DynValue[map[string]struct{}]
 }
 
-// Get retrieves the value in a thread-safe manner.
-func (d *DynStringSetValue) Get() map[string]struct{} {
-	p := (*map[string]struct{})(atomic.LoadPointer(&d.ptr))
-	return *p
-}
-
-// Set updates the value from a string representation in a thread-safe manner.
-// This operation may return an error if the provided `input` doesn't parse, or the resulting value doesn't pass an
-// optional validator.
-// If a notifier is set on the value, it will be invoked in a separate go-routine.
-func (d *DynStringSetValue) Set(val string) error {
-	v, err := csv.NewReader(strings.NewReader(val)).Read()
-	if err != nil {
-		return err
-	}
-	s := buildStringSet(v)
-	if d.validator != nil {
-		if err := d.validator(s); err != nil {
-			return err
-		}
-	}
-	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&s))
-	if d.notifier != nil {
-		go d.notifier(*(*map[string]struct{})(oldPtr), s)
-	}
-	return nil
+// View returns a read-only view of the current value.
+func (d *DynStringSetValue) View() SetView[string] {
+	return SetView[string]{items: d.Get()}
 }
 
 // Contains returns whether the specified string is in the flag.
@@ -69,32 +46,17 @@ func (d *DynStringSetValue) Contains(val string) bool {
 // Any error returned by the validator will lead to the value being rejected.
 // Validators are executed on the same go-routine as the call to `Set`.
 func (d *DynStringSetValue) WithValidator(validator func(map[string]struct{}) error) *DynStringSetValue {
-	d.validator = validator
+	d.DynValue.WithValidator(validator)
 	return d
 }
 
 // WithNotifier adds a function that is called every time a new value is successfully set.
 // Each notifier is executed asynchronously in a new go-routine.
 func (d *DynStringSetValue) WithNotifier(notifier func(oldValue map[string]struct{}, newValue map[string]struct{})) *DynStringSetValue {
-	d.notifier = notifier
+	d.DynValue.WithNotifier(notifier)
 	return d
 }
 
-// Type is an indicator of what this flag represents.
-func (d *DynStringSetValue) Type() string {
-	return "dyn_stringslice"
-}
-
-// String represents the canonical representation of the type.
-func (d *DynStringSetValue) String() string {
-	v := d.Get()
-	arr := make([]string, 0, len(v))
-	for k := range v {
-		arr = append(arr, k)
-	}
-	return fmt.Sprintf("%v", arr)
-}
-
 // ValidateDynStringSetMinElements validates that the given string slice has at least x elements.
 func ValidateDynStringSetMinElements(count int) func(map[string]struct{}) error {
 	return func(value map[string]struct{}) error {
@@ -112,3 +74,34 @@ func buildStringSet(items []string) map[string]struct{} {
 	}
 	return res
 }
+
+type stringSetCodec struct{}
+
+func (stringSetCodec) Parse(input string) (map[string]struct{}, error) {
+	v, err := csv.NewReader(strings.NewReader(input)).Read()
+	if err != nil {
+		return nil, err
+	}
+	return buildStringSet(v), nil
+}
+
+func (stringSetCodec) Format(value map[string]struct{}) string {
+	return fmt.Sprintf("%v", sortedStringSet(value))
+}
+
+func (stringSetCodec) Canonical(value map[string]struct{}) string {
+	return formatCSV(sortedStringSet(value))
+}
+
+func sortedStringSet(value map[string]struct{}) []string {
+	arr := make([]string, 0, len(value))
+	for k := range value {
+		arr = append(arr, k)
+	}
+	sort.Strings(arr)
+	return arr
+}
+
+func (stringSetCodec) Type() string {
+	return "dyn_stringslice"
+}
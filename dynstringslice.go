@@ -7,8 +7,6 @@ import (
 	"encoding/csv"
 	"fmt"
 	"strings"
-	"sync/atomic"
-	"unsafe"
 
 	flag "github.com/spf13/pflag"
 )
@@ -16,71 +14,42 @@ import (
 // DynStringSlice creates a `Flag` that represents `[]string` which is safe to change dynamically at runtime.
 // Unlike `pflag.StringSlice`, consecutive sets don't append to the slice, but override it.
 func DynStringSlice(flagSet *flag.FlagSet, name string, value []string, usage string) *DynStringSliceValue {
-	dynValue := &DynStringSliceValue{ptr: unsafe.Pointer(&value)}
+	// The default is copied, so that the caller can't modify the value shared by all readers.
+	value = append([]string(nil), value...)
+	dynValue := &DynStringSliceValue{NewDynValue[[]string](flagSet, name, value, stringSliceCodec{})}
 	flag := flagSet.VarPF(dynValue, name, "", usage)
 	MarkFlagDynamic(flag)
 	return dynValue
 }
 
-// DynStringSliceValue is a flag-related `time.Duration` value wrapper.
+// DynStringSliceValue is a flag-related `[]string` value wrapper.
+//
+// The slice returned by `Get` is shared by all readers of the flag and must not be modified, use `View` to read it
+// safely, or `View().Copy()` to get a slice the caller owns.
 type DynStringSliceValue struct {
-	ptr       unsafe.Pointer
-	validator func([]string) error
-	notifier  func(oldValue []string, newValue []string)
+	*DynValue[[]string]
 }
 
-// Get retrieves the value in a thread-safe manner.
-func (d *DynStringSliceValue) Get() []string {
-	p := (*[]string)(atomic.LoadPointer(&d.ptr))
-	return *p
-}
-
-// Set updates the value from a string representation in a thread-safe manner.
-// This operation may return an error if the provided `input` doesn't parse, or the resulting value doesn't pass an
-// optional validator.
-// If a notifier is set on the value, it will be invoked in a separate go-routine.
-func (d *DynStringSliceValue) Set(val string) error {
-	v, err := csv.NewReader(strings.NewReader(val)).Read()
-	if err != nil {
-		return err
-	}
-	if d.validator != nil {
-		if err := d.validator(v); err != nil {
-			return err
-		}
-	}
-	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&v))
-	if d.notifier != nil {
-		go d.notifier(*(*[]string)(oldPtr), v)
-	}
-	return nil
+// View returns a read-only view of the current value.
+func (d *DynStringSliceValue) View() SliceView[string] {
+	return SliceView[string]{items: d.Get()}
 }
 
 // WithValidator adds a function that checks values before they're set.
 // Any error returned by the validator will lead to the value being rejected.
 // Validators are executed on the same go-routine as the call to `Set`.
 func (d *DynStringSliceValue) WithValidator(validator func([]string) error) *DynStringSliceValue {
-	d.validator = validator
+	d.DynValue.WithValidator(validator)
 	return d
 }
 
 // WithNotifier adds a function that is called every time a new value is successfully set.
 // Each notifier is executed asynchronously in a new go-routine.
 func (d *DynStringSliceValue) WithNotifier(notifier func(oldValue []string, newValue []string)) *DynStringSliceValue {
-	d.notifier = notifier
+	d.DynValue.WithNotifier(notifier)
 	return d
 }
 
-// Type is an indicator of what this flag represents.
-func (d *DynStringSliceValue) Type() string {
-	return "dyn_stringslice"
-}
-
-// String represents the canonical representation of the type.
-func (d *DynStringSliceValue) String() string {
-	return fmt.Sprintf("%v", d.Get())
-}
-
 // ValidateDynStringSliceMinElements validates that the given string slice has at least x elements.
 func ValidateDynStringSliceMinElements(count int) func([]string) error {
 	return func(value []string) error {
@@ -90,3 +59,21 @@ func ValidateDynStringSliceMinElements(count int) func([]string) error {
 		return nil
 	}
 }
+
+type stringSliceCodec struct{}
+
+func (stringSliceCodec) Parse(input string) ([]string, error) {
+	return csv.NewReader(strings.NewReader(input)).Read()
+}
+
+func (stringSliceCodec) Format(value []string) string {
+	return fmt.Sprintf("%v", value)
+}
+
+func (stringSliceCodec) Canonical(value []string) string {
+	return formatCSV(value)
+}
+
+func (stringSliceCodec) Type() string {
+	return "dyn_stringslice"
+}
@@ -0,0 +1,532 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Codec converts values of a dynamic flag to and from their string representation.
+type Codec[T any] interface {
+	// Parse converts the string representation of a flag into a value.
+	Parse(input string) (T, error)
+	// Format returns the string representation of a value, as shown by `String`, e.g. on the status endpoint. It is
+	// meant for display and needn't be accepted by Parse: e.g. slices are formatted as `[a b]`, while their canonical
+	// representation, see `CanonicalStringer`, is the comma-separated form that Parse accepts.
+	Format(value T) string
+	// Type is an indicator of what the flag represents, e.g. `dyn_int64`.
+	Type() string
+}
+
+// NewCodec builds a `Codec` out of a type name and a pair of parse and format functions.
+func NewCodec[T any](typeName string, parse func(input string) (T, error), format func(value T) string) Codec[T] {
+	return &funcCodec[T]{typeName: typeName, parse: parse, format: format}
+}
+
+type funcCodec[T any] struct {
+	typeName string
+	parse    func(string) (T, error)
+	format   func(T) string
+}
+
+func (c *funcCodec[T]) Parse(input string) (T, error) {
+	return c.parse(input)
+}
+
+func (c *funcCodec[T]) Format(value T) string {
+	return c.format(value)
+}
+
+func (c *funcCodec[T]) Type() string {
+	return c.typeName
+}
+
+// Dyn creates a `Flag` that represents a value of an arbitrary type `T` which is safe to change dynamically at runtime.
+// The `codec` is used to parse new values of the flag and to print out its current value.
+func Dyn[T any](flagSet *flag.FlagSet, name string, value T, codec Codec[T], usage string) *DynValue[T] {
+	dynValue := NewDynValue(flagSet, name, value, codec)
+	flag := flagSet.VarPF(dynValue, name, "", usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynValue is a flag-related value wrapper of an arbitrary type `T`.
+// All the typed dynamic flags of this package are built on top of it.
+type DynValue[T any] struct {
+	ptr        atomic.Pointer[T]
+	defaultPtr *T
+	codec      Codec[T]
+	setMu      sync.Mutex
+	hooksMu    sync.Mutex
+	validators []*validatorHook[T]
+	commits    []*commitHook[T]
+	notifiers  []*notifierHook[T]
+	listeners  []*listenerHook[T]
+	delivery   NotifierDelivery
+	queue      deliveryQueue[T]
+	history    atomic.Pointer[history]
+	source     atomic.Pointer[Source]
+	secret     atomic.Bool
+	flagName   string
+	flagSet    *flag.FlagSet
+	setState   *flagSetState
+	// override is the active temporary override, guarded by `setMu`.
+	override *overrideState[T]
+	// appliedInput is set while `markFlagSet` lets `pflag` record an already applied value, so that the call to `Set`
+	// it makes doesn't apply the value again.
+	appliedInput atomic.Pointer[string]
+}
+
+type validatorHook[T any] struct {
+	fn func(T) error
+}
+
+type commitHook[T any] struct {
+	fn func(oldValue T, newValue T) error
+}
+
+type notifierHook[T any] struct {
+	fn func(oldValue T, newValue T)
+}
+
+// listenerHook is an internal, non-blocking subscriber invoked synchronously after each committed update.
+type listenerHook[T any] struct {
+	fn func(oldValue T, newValue T, source Source)
+}
+
+// HookRegistration is a handle to a validator, commit hook or notifier added to a dynamic flag.
+type HookRegistration struct {
+	once   sync.Once
+	remove func()
+}
+
+// Unregister removes the hook from the flag, so it will not be invoked on subsequent updates.
+// Notifiers that were already dispatched for previous updates may still run.
+// It is safe to call Unregister multiple times.
+func (r *HookRegistration) Unregister() {
+	r.once.Do(r.remove)
+}
+
+// NewDynValue creates a `DynValue` bound to the flag `name` in the `flagSet`, but doesn't register it.
+// It is meant for typed wrappers around `DynValue` that register themselves as the flag's `Value`, and must be followed
+// by a call to `flagSet.VarPF` and `MarkFlagDynamic`.
+func NewDynValue[T any](flagSet *flag.FlagSet, name string, value T, codec Codec[T]) *DynValue[T] {
+	d := &DynValue[T]{codec: codec, flagName: name, flagSet: flagSet, setState: flagSetStateOf(flagSet), defaultPtr: &value}
+	d.ptr.Store(&value)
+	d.history.Store(newHistory(DefaultHistorySize))
+	d.storeSource(SourceDefault)
+	return d
+}
+
+// Get retrieves the value in a thread-safe manner.
+func (d *DynValue[T]) Get() T {
+	return *d.ptr.Load()
+}
+
+// Set updates the value from a string representation in a thread-safe manner.
+// This operation may return an error if the provided `input` doesn't parse, or the resulting value doesn't pass an
+// optional validator.
+// If commit hooks are set on the value, they are invoked after the value is swapped and any error they return will
+// lead to the value being swapped back and returned.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+// The new value is attributed to `SourceCommandLine`, use `SetFrom` to record a different provenance.
+func (d *DynValue[T]) Set(input string) error {
+	if p := d.appliedInput.Load(); p != nil && *p == input && d.appliedInput.CompareAndSwap(p, nil) {
+		return nil
+	}
+	return d.SetFrom(input, SourceCommandLine)
+}
+
+// skipSetOf makes the next call to `Set` with `input` a no-op, until `done` is called.
+func (d *DynValue[T]) skipSetOf(input string) (done func()) {
+	p := &input
+	d.appliedInput.Store(p)
+	return func() { d.appliedInput.CompareAndSwap(p, nil) }
+}
+
+// SetFrom is like `Set`, but records `source` as the provenance of the new value.
+func (d *DynValue[T]) SetFrom(input string, source Source) error {
+	val, err := d.codec.Parse(input)
+	if err != nil {
+		err = d.redactErr(err)
+		d.recordRejectedInput(input, source, err)
+		return err
+	}
+	return d.apply(val, source)
+}
+
+// Source returns where the current value came from, see `flagz.FlagSource`.
+func (d *DynValue[T]) Source() Source {
+	return *d.source.Load()
+}
+
+func (d *DynValue[T]) storeSource(source Source) {
+	d.source.Store(&source)
+}
+
+// Reset reverts the value to the default it was created with, in a thread-safe manner.
+// The default value goes through the same validators, commit hooks and notifiers as values passed to `Set`.
+//
+// Afterwards the value is attributed to `SourceDefault`, see `flagz.FlagSource`.
+func (d *DynValue[T]) Reset() error {
+	return d.apply(*d.defaultPtr, SourceDefault)
+}
+
+// Default returns the value this flag was created with.
+func (d *DynValue[T]) Default() T {
+	return *d.defaultPtr
+}
+
+func (d *DynValue[T]) apply(val T, source Source) error {
+	return d.applyWithTTL(val, source, 0)
+}
+
+// applyWithTTL applies the value, and if `ttl` is positive, makes it a temporary override, see `SetWithTTL`.
+func (d *DynValue[T]) applyWithTTL(val T, source Source, ttl time.Duration) error {
+	update, err := d.stageValue(val, source)
+	if err != nil {
+		return err
+	}
+	update.ttl = ttl
+	if state := d.setState; state.hasValidatorsFor(d.flagName) {
+		state.commitMu.Lock()
+		defer state.commitMu.Unlock()
+		if err := state.validate(d.flagSet, map[string]interface{}{d.flagName: val}); err != nil {
+			err = d.redactErr(err)
+			update.reject(err)
+			return err
+		}
+	}
+	// Swapping and queueing notifications happen under one lock, so that queued deliveries follow the swap order.
+	update.lock()
+	defer update.unlock()
+	update.swap()
+	if err := update.commit(update.restore); err != nil {
+		return err
+	}
+	update.finish()
+	return nil
+}
+
+// stage parses and validates the `input`, preparing it to be swapped in as part of a batch, see `ApplyBatch`.
+func (d *DynValue[T]) stage(input string, source Source) (stagedUpdate, error) {
+	val, err := d.codec.Parse(input)
+	if err != nil {
+		err = d.redactErr(err)
+		d.recordRejectedInput(input, source, err)
+		return nil, err
+	}
+	return d.stageValue(val, source)
+}
+
+func (d *DynValue[T]) stageAny(value interface{}, source Source) (stagedUpdate, error) {
+	val, ok := value.(T)
+	if !ok {
+		return nil, fmt.Errorf("value of type %T doesn't match flag type %v", value, d.Type())
+	}
+	return d.stageValue(val, source)
+}
+
+func (d *DynValue[T]) stageValue(val T, source Source) (*dynStagedUpdate[T], error) {
+	d.hooksMu.Lock()
+	validators := d.validators
+	d.hooksMu.Unlock()
+	for _, v := range validators {
+		if err := v.fn(val); err != nil {
+			err = d.redactErr(err)
+			d.recordChange(d.Get(), val, source, err)
+			return nil, err
+		}
+	}
+	return &dynStagedUpdate[T]{d: d, val: val, source: source}, nil
+}
+
+// dynStagedUpdate is a validated value of a `DynValue`, waiting to be swapped in.
+type dynStagedUpdate[T any] struct {
+	d         *DynValue[T]
+	val       T
+	source    Source
+	ttl       time.Duration
+	oldPtr    *T
+	oldSource Source
+	// toBase is set for updates made while a temporary override is active, they only replace the value the override
+	// reverts to.
+	toBase        bool
+	oldBase       T
+	oldBaseSource Source
+	commits       []*commitHook[T]
+	notifiers     []*notifierHook[T]
+	listeners     []*listenerHook[T]
+	delivery      NotifierDelivery
+
+	// clearsOverride makes the update replace the value of an active temporary override, which is then dropped as
+	// `clearedOverride`.
+	clearsOverride  bool
+	clearedOverride *overrideState[T]
+}
+
+func (u *dynStagedUpdate[T]) value() interface{} {
+	return u.val
+}
+
+func (u *dynStagedUpdate[T]) clearOverride() {
+	u.clearsOverride = true
+}
+
+func (u *dynStagedUpdate[T]) reject(err error) {
+	u.d.recordChange(u.d.Get(), u.val, u.source, u.d.redactErr(err))
+}
+
+func (u *dynStagedUpdate[T]) lock() {
+	u.d.setMu.Lock()
+}
+
+func (u *dynStagedUpdate[T]) unlock() {
+	u.d.setMu.Unlock()
+}
+
+func (u *dynStagedUpdate[T]) swap() {
+	d := u.d
+	if o := d.override; o != nil && u.ttl <= 0 && u.clearsOverride {
+		u.clearedOverride = o
+		d.override = nil
+	} else if o != nil && u.ttl <= 0 {
+		u.toBase = true
+		u.oldBase, u.oldBaseSource = o.base, o.baseSource
+		o.base, o.baseSource = u.val, u.source
+		return
+	}
+	d.hooksMu.Lock()
+	u.commits, u.notifiers, u.listeners, u.delivery = d.commits, d.notifiers, d.listeners, d.delivery
+	d.hooksMu.Unlock()
+	u.oldSource = d.Source()
+	u.oldPtr = d.ptr.Swap(&u.val)
+}
+
+func (u *dynStagedUpdate[T]) commit(restore func()) error {
+	d := u.d
+	if u.toBase {
+		return nil
+	}
+	if err := runCommitHooks(u.commits, *u.oldPtr, u.val, restore); err != nil {
+		err = d.redactErr(err)
+		d.recordChange(*u.oldPtr, u.val, u.source, err)
+		return err
+	}
+	return nil
+}
+
+func (u *dynStagedUpdate[T]) restore() {
+	if u.toBase {
+		u.d.override.base, u.d.override.baseSource = u.oldBase, u.oldBaseSource
+		return
+	}
+	u.d.ptr.Store(u.oldPtr)
+	if u.clearedOverride != nil {
+		u.d.override = u.clearedOverride
+	}
+}
+
+func (u *dynStagedUpdate[T]) undo() {
+	if u.toBase {
+		return
+	}
+	for j := len(u.commits) - 1; j >= 0; j-- {
+		u.commits[j].fn(u.val, *u.oldPtr)
+	}
+}
+
+func (u *dynStagedUpdate[T]) finish() {
+	d := u.d
+	if u.toBase {
+		return
+	}
+	if u.ttl > 0 {
+		d.installOverride(*u.oldPtr, u.oldSource, u.ttl)
+	}
+	if u.clearedOverride != nil {
+		u.clearedOverride.timer.Stop()
+	}
+	d.storeSource(u.source)
+	d.setState.version.Add(1)
+	d.recordChange(*u.oldPtr, u.val, u.source, nil)
+	for _, l := range u.listeners {
+		l.fn(*u.oldPtr, u.val, u.source)
+	}
+	d.notify(u.delivery, u.notifiers, *u.oldPtr, u.val)
+}
+
+// runCommitHooks invokes the commit hooks in order. If one of them fails, the old value is restored and the hooks that
+// already succeeded are invoked again, in reverse order, with the old and new values swapped so they can undo their
+// changes.
+func runCommitHooks[T any](commits []*commitHook[T], oldValue T, newValue T, restore func()) error {
+	for i, c := range commits {
+		if err := c.fn(oldValue, newValue); err != nil {
+			restore()
+			for j := i - 1; j >= 0; j-- {
+				commits[j].fn(newValue, oldValue)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+// Calling it multiple times adds multiple validators, see `AddValidator`.
+func (d *DynValue[T]) WithValidator(validator func(T) error) *DynValue[T] {
+	d.AddValidator(validator)
+	return d
+}
+
+// WithNotifier adds a function that is called every time a new value is successfully set.
+// Each notifier is executed asynchronously in a new go-routine.
+// Calling it multiple times adds multiple notifiers, see `AddNotifier`.
+func (d *DynValue[T]) WithNotifier(notifier func(oldValue T, newValue T)) *DynValue[T] {
+	d.AddNotifier(notifier)
+	return d
+}
+
+// WithCommitHook adds a function that applies a new value synchronously, as part of the call to `Set`.
+// Calling it multiple times adds multiple commit hooks, see `AddCommitHook`.
+func (d *DynValue[T]) WithCommitHook(hook func(oldValue T, newValue T) error) *DynValue[T] {
+	d.AddCommitHook(hook)
+	return d
+}
+
+// WithNotifierDelivery changes how the notifiers of this flag are invoked, see `NotifierDelivery`.
+// By default every notifier is invoked in a new go-routine on each update (`DeliverAsync`).
+func (d *DynValue[T]) WithNotifierDelivery(delivery NotifierDelivery) *DynValue[T] {
+	d.hooksMu.Lock()
+	d.delivery = delivery
+	d.hooksMu.Unlock()
+	return d
+}
+
+// WithNotifierQueueSize bounds the number of updates queued for `DeliverOrdered` notifiers of this flag, which is
+// `DefaultNotifierQueueSize` by default. When a slow notifier lets the queue fill up, its two oldest updates are
+// coalesced into one, so memory stays bounded even if the flag keeps changing.
+func (d *DynValue[T]) WithNotifierQueueSize(size int) *DynValue[T] {
+	d.queue.setSize(size)
+	return d
+}
+
+// AddValidator appends a function to the chain of functions that check values before they're set.
+// Validators run in the order they were added, on the same go-routine as the call to `Set`. The first one to return
+// an error rejects the value, and the remaining ones are not run.
+func (d *DynValue[T]) AddValidator(validator func(T) error) *HookRegistration {
+	hook := &validatorHook[T]{fn: validator}
+	d.hooksMu.Lock()
+	d.validators = append(d.validators[:len(d.validators):len(d.validators)], hook)
+	d.hooksMu.Unlock()
+	return &HookRegistration{remove: func() {
+		d.hooksMu.Lock()
+		d.validators = removeHook(d.validators, hook)
+		d.hooksMu.Unlock()
+	}}
+}
+
+// AddCommitHook appends a function to the chain of functions that apply a new value synchronously.
+// Commit hooks run in the order they were added, on the same go-routine as the call to `Set`, after validators passed
+// and the new value was swapped in, but before any notifiers are invoked.
+// If a commit hook returns an error, the update is vetoed: the hooks that already ran are invoked again with the old
+// and new values swapped, the previous value is swapped back, and `Set` returns the error. This allows remote
+// updaters, such as the etcd `Watcher`, to roll back changes that could not be applied.
+// Commit hooks must not update the flag they're registered on, nor flags of the same `FlagSet` that have flag set
+// validators or are part of the same `ApplyBatch`. They may read the `FlagSet`, e.g. with `Snapshot` or
+// `ReadConsistent`.
+func (d *DynValue[T]) AddCommitHook(hook func(oldValue T, newValue T) error) *HookRegistration {
+	commit := &commitHook[T]{fn: hook}
+	d.hooksMu.Lock()
+	d.commits = append(d.commits[:len(d.commits):len(d.commits)], commit)
+	d.hooksMu.Unlock()
+	return &HookRegistration{remove: func() {
+		d.hooksMu.Lock()
+		d.commits = removeHook(d.commits, commit)
+		d.hooksMu.Unlock()
+	}}
+}
+
+// AddNotifier appends a function to the set of functions called every time a new value is successfully set.
+// Notifiers are executed asynchronously, in a way specified by `WithNotifierDelivery`.
+func (d *DynValue[T]) AddNotifier(notifier func(oldValue T, newValue T)) *HookRegistration {
+	hook := &notifierHook[T]{fn: notifier}
+	d.hooksMu.Lock()
+	d.notifiers = append(d.notifiers[:len(d.notifiers):len(d.notifiers)], hook)
+	d.hooksMu.Unlock()
+	return &HookRegistration{remove: func() {
+		d.hooksMu.Lock()
+		d.notifiers = removeHook(d.notifiers, hook)
+		d.hooksMu.Unlock()
+	}}
+}
+
+// WithFileFlag adds an companion <name>_path flag that allows this value to be read from a file with flagz.ReadFileFlags.
+//
+// This is useful for reading large values, such as JSON files, as flags. If the companion flag's value (whether
+// default or overwritten) is set to empty string, nothing is read.
+//
+// Flag value reads are subject to notifiers and validators.
+func (d *DynValue[T]) WithFileFlag(defaultPath string) *DynValue[T] {
+	FileReadFlag(d.flagSet, d.flagName, defaultPath)
+	return d
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynValue[T]) Type() string {
+	return d.codec.Type()
+}
+
+// String returns the canonical string representation of the type.
+func (d *DynValue[T]) String() string {
+	return d.codec.Format(d.Get())
+}
+
+func (d *DynValue[T]) getAny() interface{} {
+	return d.Get()
+}
+
+func (d *DynValue[T]) formatAny(value interface{}) (string, bool) {
+	val, ok := value.(T)
+	if !ok {
+		return "", false
+	}
+	return d.codec.Format(val), true
+}
+
+// addListener registers a subscriber that is invoked synchronously, in order, after every committed update.
+// The current value and its source are passed to `initial` atomically with respect to updates, so no change can be
+// missed.
+func (d *DynValue[T]) addListener(initial func(value T, source Source), fn func(oldValue T, newValue T, source Source)) (remove func()) {
+	hook := &listenerHook[T]{fn: fn}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	initial(d.Get(), d.Source())
+	d.hooksMu.Lock()
+	d.listeners = append(d.listeners[:len(d.listeners):len(d.listeners)], hook)
+	d.hooksMu.Unlock()
+	return func() {
+		d.hooksMu.Lock()
+		d.listeners = removeHook(d.listeners, hook)
+		d.hooksMu.Unlock()
+	}
+}
+
+// removeHook returns a copy of hooks without the given hook, leaving the original slice intact for concurrent readers.
+func removeHook[H comparable](hooks []H, hook H) []H {
+	ret := make([]H, 0, len(hooks))
+	for _, h := range hooks {
+		if h != hook {
+			ret = append(ret, h)
+		}
+	}
+	return ret
+}
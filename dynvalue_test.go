@@ -0,0 +1,243 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPolicy string
+
+var testPolicyCodec = NewCodec[testPolicy](
+	"dyn_test_policy",
+	func(input string) (testPolicy, error) {
+		switch p := testPolicy(strings.ToLower(input)); p {
+		case "allow", "deny":
+			return p, nil
+		}
+		return "", fmt.Errorf("unknown policy %q", input)
+	},
+	func(value testPolicy) string { return string(value) },
+)
+
+func TestDyn_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := Dyn(set, "some_policy_1", testPolicy("allow"), testPolicyCodec, "Use it or lose it")
+	assert.Equal(t, testPolicy("allow"), dynFlag.Get(), "value must be default after create")
+	err := set.Set("some_policy_1", "DENY")
+	assert.NoError(t, err, "setting value must succeed")
+	assert.Equal(t, testPolicy("deny"), dynFlag.Get(), "value must be set after update")
+	assert.Error(t, set.Set("some_policy_1", "shadow"), "setting a value that doesn't parse must fail")
+	assert.Equal(t, testPolicy("deny"), dynFlag.Get(), "value must not change after failed parse")
+}
+
+func TestDyn_UsesCodecForFlagRepresentation(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	Dyn(set, "some_policy_1", testPolicy("allow"), testPolicyCodec, "Use it or lose it")
+	f := set.Lookup("some_policy_1")
+	assert.True(t, IsFlagDynamic(f))
+	assert.Equal(t, "dyn_test_policy", f.Value.Type())
+	assert.Equal(t, "allow", f.DefValue)
+	set.Set("some_policy_1", "deny")
+	assert.Equal(t, "deny", f.Value.String())
+}
+
+func TestDyn_FiresValidators(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	validator := func(value testPolicy) error {
+		if value == "deny" {
+			return fmt.Errorf("deny is not allowed")
+		}
+		return nil
+	}
+	Dyn(set, "some_policy_1", testPolicy("allow"), testPolicyCodec, "Use it or lose it").WithValidator(validator)
+
+	assert.NoError(t, set.Set("some_policy_1", "allow"), "no error from validator when value is ok")
+	assert.Error(t, set.Set("some_policy_1", "deny"), "error from validator when value is rejected")
+}
+
+func TestDyn_FiresNotifier(t *testing.T) {
+	waitCh := make(chan bool, 1)
+	notifier := func(oldVal testPolicy, newVal testPolicy) {
+		assert.EqualValues(t, "allow", oldVal, "old value in notify must match previous value")
+		assert.EqualValues(t, "deny", newVal, "new value in notify must match set value")
+		waitCh <- true
+	}
+
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	Dyn(set, "some_policy_1", testPolicy("allow"), testPolicyCodec, "Use it or lose it").WithNotifier(notifier)
+	set.Set("some_policy_1", "deny")
+	select {
+	case <-time.After(5 * time.Millisecond):
+		assert.Fail(t, "failed to trigger notifier")
+	case <-waitCh:
+	}
+}
+
+func TestDyn_RunsValidatorsInOrderUntilFirstFailure(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := Dyn(set, "some_policy_1", testPolicy("allow"), testPolicyCodec, "Use it or lose it")
+	calls := []string{}
+	dynFlag.AddValidator(func(value testPolicy) error {
+		calls = append(calls, "first")
+		return nil
+	})
+	dynFlag.AddValidator(func(value testPolicy) error {
+		calls = append(calls, "second")
+		if value == "deny" {
+			return fmt.Errorf("deny is not allowed")
+		}
+		return nil
+	})
+	dynFlag.AddValidator(func(value testPolicy) error {
+		calls = append(calls, "third")
+		return nil
+	})
+
+	assert.Error(t, set.Set("some_policy_1", "deny"), "second validator must reject the value")
+	assert.Equal(t, []string{"first", "second"}, calls, "validators must run in order and stop at first failure")
+	assert.Equal(t, testPolicy("allow"), dynFlag.Get(), "value must not change after a rejection")
+}
+
+func TestDyn_UnregisteredValidatorIsNotRun(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := Dyn(set, "some_policy_1", testPolicy("allow"), testPolicyCodec, "Use it or lose it")
+	reg := dynFlag.AddValidator(func(value testPolicy) error { return fmt.Errorf("always fails") })
+	assert.Error(t, set.Set("some_policy_1", "deny"))
+	reg.Unregister()
+	reg.Unregister()
+	assert.NoError(t, set.Set("some_policy_1", "deny"), "validator must not run after unregistering")
+}
+
+func TestDyn_FiresAllNotifiersUntilUnregistered(t *testing.T) {
+	firstCh := make(chan testPolicy, 10)
+	secondCh := make(chan testPolicy, 10)
+
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := Dyn(set, "some_policy_1", testPolicy("allow"), testPolicyCodec, "Use it or lose it")
+	dynFlag.AddNotifier(func(oldVal testPolicy, newVal testPolicy) { firstCh <- newVal })
+	secondReg := dynFlag.AddNotifier(func(oldVal testPolicy, newVal testPolicy) { secondCh <- newVal })
+
+	set.Set("some_policy_1", "deny")
+	for _, ch := range []chan testPolicy{firstCh, secondCh} {
+		select {
+		case <-time.After(5 * time.Millisecond):
+			assert.Fail(t, "failed to trigger notifier")
+		case val := <-ch:
+			assert.EqualValues(t, "deny", val)
+		}
+	}
+
+	secondReg.Unregister()
+	set.Set("some_policy_1", "allow")
+	select {
+	case <-time.After(5 * time.Millisecond):
+		assert.Fail(t, "failed to trigger notifier that is still registered")
+	case val := <-firstCh:
+		assert.EqualValues(t, "allow", val)
+	}
+	select {
+	case <-time.After(5 * time.Millisecond):
+	case <-secondCh:
+		assert.Fail(t, "unregistered notifier must not be triggered")
+	}
+}
+
+func TestDyn_CommitHookVetoRollsBackValue(t *testing.T) {
+	notifiedCh := make(chan testPolicy, 10)
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := Dyn(set, "some_policy_1", testPolicy("allow"), testPolicyCodec, "Use it or lose it")
+	dynFlag.AddNotifier(func(oldVal testPolicy, newVal testPolicy) { notifiedCh <- newVal })
+
+	applied := []string{}
+	dynFlag.AddCommitHook(func(oldVal testPolicy, newVal testPolicy) error {
+		assert.Equal(t, newVal, dynFlag.Get(), "commit hooks must see the value they're applying swapped in")
+		applied = append(applied, fmt.Sprintf("%v->%v", oldVal, newVal))
+		return nil
+	})
+	dynFlag.AddCommitHook(func(oldVal testPolicy, newVal testPolicy) error {
+		if newVal == "deny" {
+			return fmt.Errorf("cannot apply deny")
+		}
+		return nil
+	})
+
+	err := set.Set("some_policy_1", "deny")
+	require.Error(t, err, "a failing commit hook must fail the Set")
+	assert.Contains(t, err.Error(), "cannot apply deny", "Set must return the commit hook's error")
+	assert.Equal(t, testPolicy("allow"), dynFlag.Get(), "value must be swapped back after a veto")
+	assert.Equal(t, []string{"allow->deny", "deny->allow"}, applied, "succeeded hooks must be asked to undo their changes")
+	select {
+	case <-time.After(5 * time.Millisecond):
+	case <-notifiedCh:
+		assert.Fail(t, "notifiers must not be invoked for vetoed updates")
+	}
+}
+
+func TestDyn_CommitHookAcceptsValue(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := Dyn(set, "some_policy_1", testPolicy("allow"), testPolicyCodec, "Use it or lose it")
+	var committed testPolicy
+	dynFlag.WithCommitHook(func(oldVal testPolicy, newVal testPolicy) error {
+		committed = newVal
+		return nil
+	})
+	require.NoError(t, set.Set("some_policy_1", "deny"))
+	assert.Equal(t, testPolicy("deny"), committed, "commit hook must run synchronously on Set")
+	assert.Equal(t, testPolicy("deny"), dynFlag.Get())
+}
+
+func TestDyn_ResetRevertsToDefault(t *testing.T) {
+	notifiedCh := make(chan Change[testPolicy], 10)
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := Dyn(set, "some_policy_1", testPolicy("allow"), testPolicyCodec, "Use it or lose it")
+	dynFlag.AddNotifier(func(oldVal testPolicy, newVal testPolicy) { notifiedCh <- Change[testPolicy]{oldVal, newVal} })
+
+	require.NoError(t, set.Set("some_policy_1", "deny"))
+	<-notifiedCh
+	require.True(t, set.Lookup("some_policy_1").Changed)
+	require.Equal(t, SourceCommandLine, FlagSource(set.Lookup("some_policy_1")))
+
+	require.NoError(t, ResetFlag(set, "some_policy_1"), "resetting must succeed")
+	assert.Equal(t, testPolicy("allow"), dynFlag.Get(), "value must be default after reset")
+	assert.Equal(t, testPolicy("allow"), dynFlag.Default())
+	assert.False(t, set.Lookup("some_policy_1").Changed, "reset flag must not be marked as changed")
+	assert.Equal(t, SourceDefault, FlagSource(set.Lookup("some_policy_1")), "reset flag must come from its default")
+	select {
+	case <-time.After(5 * time.Millisecond):
+		assert.Fail(t, "reset must trigger notifiers")
+	case c := <-notifiedCh:
+		assert.Equal(t, Change[testPolicy]{"deny", "allow"}, c)
+	}
+}
+
+func TestDyn_ResetIsSubjectToValidators(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := Dyn(set, "some_policy_1", testPolicy("allow"), testPolicyCodec, "Use it or lose it")
+	require.NoError(t, set.Set("some_policy_1", "deny"))
+	dynFlag.AddValidator(func(value testPolicy) error {
+		if value == "allow" {
+			return fmt.Errorf("allow is no longer allowed")
+		}
+		return nil
+	})
+	assert.Error(t, ResetFlag(set, "some_policy_1"), "reset must fail if the default doesn't validate")
+	assert.Equal(t, testPolicy("deny"), dynFlag.Get(), "value must not change after a failed reset")
+	assert.True(t, set.Lookup("some_policy_1").Changed, "flag must remain changed after a failed reset")
+	assert.Equal(t, SourceCommandLine, FlagSource(set.Lookup("some_policy_1")), "source must not change after a failed reset")
+}
+
+func TestResetFlag_FailsForStaticAndUnknownFlags(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	set.String("some_static_string", "foo", "Use it or lose it")
+	assert.Error(t, ResetFlag(set, "some_static_string"))
+	assert.Error(t, ResetFlag(set, "unknown_flag"))
+}
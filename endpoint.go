@@ -5,37 +5,81 @@ package flagz
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"html/template"
 	"log"
 	"net/http"
 	"strings"
-	"text/template"
+	"sync"
+	"time"
 
 	"fmt"
 
 	flag "github.com/spf13/pflag"
 )
 
+// MaxEndpointSnapshots is the number of snapshots kept by a `StatusEndpoint`, older ones are dropped.
+const MaxEndpointSnapshots = 16
+
+// UpdateRequestHeader is the header that scripts and tools must set on requests that update flags through a
+// `StatusEndpoint`, e.g. `X-Flagz-Update: 1`. Browsers don't send custom headers cross-origin without a CORS preflight,
+// so other pages the operator visits can't make such requests. The HTML forms of the endpoint send a CSRF token
+// instead.
+const UpdateRequestHeader = "X-Flagz-Update"
+
 // StatusEndpoint is a collection of `http.HandlerFunc` that serve debug pages about a given `FlagSet.
 type StatusEndpoint struct {
-	flagSet *flag.FlagSet
+	flagSet        *flag.FlagSet
+	updatesEnabled bool
+	csrfToken      string
+	snapshotsMu    sync.Mutex
+	snapshots      []*FlagSetSnapshot
 }
 
 // NewStatusEndpoint creates a new debug `http.HandlerFunc` collection for a given `FlagSet`
 func NewStatusEndpoint(flagSet *flag.FlagSet) *StatusEndpoint {
-	return &StatusEndpoint{flagSet: flagSet}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		panic(fmt.Sprintf("flagz: failed generating CSRF token: %v", err))
+	}
+	return &StatusEndpoint{flagSet: flagSet, csrfToken: hex.EncodeToString(token)}
+}
+
+// WithUpdatesEnabled allows the handlers of this endpoint to change values of flags, e.g. to restore snapshots.
+// By default the endpoint is read-only, since it is usually served without authentication.
+//
+// Requests that change flags must either come from the forms of the endpoint's HTML pages, which carry a CSRF token,
+// or set the `UpdateRequestHeader`.
+func (e *StatusEndpoint) WithUpdatesEnabled() *StatusEndpoint {
+	e.updatesEnabled = true
+	return e
 }
 
 // ListFlags provides an HTML and JSON `http.HandlerFunc` that lists all Flags of a `FlagSet`.
 // Additional URL query parameters can be used such as `type=[dynamic,static]` or `only_changed=true`.
+//
+// With `WithUpdatesEnabled`, the HTML page renders toggles of `DynBool` flags and dropdowns of `DynEnum` flags, which
+// `POST` the same form parameters as `SetFlag` back to this handler.
 func (e *StatusEndpoint) ListFlags(resp http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodPost {
+		if _, err := e.setFlag(req); err != nil {
+			http.Error(resp, err.Error(), err.code)
+			return
+		}
+		// Post/Redirect/Get, so that reloading the page doesn't repeat the toggle.
+		http.Redirect(resp, req, req.URL.RequestURI(), http.StatusSeeOther)
+		return
+	}
 	onlyChanged := req.URL.Query().Get("only_changed") != ""
 	onlyDynamic := req.URL.Query().Get("type") == "dynamic"
 	onlyStatic := req.URL.Query().Get("type") == "static"
 
-	flagSetJSON := &flagSetJSON{}
+	flagSetJSON := &flagSetJSON{UpdatesEnabled: e.updatesEnabled, CSRFToken: e.csrfToken}
 	e.flagSet.VisitAll(func(f *flag.Flag) {
-		if onlyChanged && !f.Changed {
+		if onlyChanged && !isFlagChanged(f) {
 			return
 		}
 		if onlyDynamic && !IsFlagDynamic(f) {
@@ -67,6 +111,197 @@ func (e *StatusEndpoint) ListFlags(resp http.ResponseWriter, req *http.Request)
 	}
 }
 
+// FlagHistory provides an HTML and JSON `http.HandlerFunc` that lists the latest changes of a single dynamic Flag.
+// The flag is selected with the `flag=<name>` URL query parameter.
+func (e *StatusEndpoint) FlagHistory(resp http.ResponseWriter, req *http.Request) {
+	flagName := req.URL.Query().Get("flag")
+	entries, err := FlagHistory(e.flagSet, flagName)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusNotFound)
+		return
+	}
+	historyJSON := &flagHistoryJSON{Name: flagName, History: []*historyEntryJSON{}}
+	for i := len(entries) - 1; i >= 0; i-- {
+		historyJSON.History = append(historyJSON.History, historyEntryToJSON(entries[i]))
+	}
+
+	if requestIsBrowser(req) && req.URL.Query().Get("format") != "json" {
+		resp.WriteHeader(http.StatusOK)
+		resp.Header().Add("Content-Type", "text/html")
+		if err := flagzHistoryTemplate.Execute(resp, historyJSON); err != nil {
+			log.Fatalf("Bad template evaluation: %v", err)
+		}
+	} else {
+		resp.Header().Add("Content-Type", "application/json")
+		out, err := json.MarshalIndent(&historyJSON, "", "  ")
+		if err != nil {
+			resp.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		resp.WriteHeader(http.StatusOK)
+		resp.Write(out)
+	}
+}
+
+// Snapshots provides an HTML and JSON `http.HandlerFunc` that takes, lists and restores snapshots of dynamic Flags.
+//
+// A `POST` request takes a new snapshot, and a `POST` with the `restore=<version>` URL query parameter rolls all dynamic
+// flags back to the snapshot of that version, see `flagz.Restore`. Both require `WithUpdatesEnabled`.
+func (e *StatusEndpoint) Snapshots(resp http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodPost {
+		if err := e.checkUpdateAllowed(req); err != nil {
+			http.Error(resp, err.Error(), err.code)
+			return
+		}
+		restore := req.URL.Query().Get("restore")
+		if restore == "" {
+			snapshot := Snapshot(e.flagSet)
+			e.snapshotsMu.Lock()
+			if n := len(e.snapshots); n > 0 && e.snapshots[n-1].Version() == snapshot.Version() {
+				// nothing changed since the last snapshot
+				e.snapshots = e.snapshots[:n-1]
+			}
+			e.snapshots = append(e.snapshots, snapshot)
+			if len(e.snapshots) > MaxEndpointSnapshots {
+				e.snapshots = e.snapshots[len(e.snapshots)-MaxEndpointSnapshots:]
+			}
+			e.snapshotsMu.Unlock()
+		} else if err := e.restoreSnapshot(restore); err != nil {
+			http.Error(resp, err.Error(), err.code)
+			return
+		}
+		// Post/Redirect/Get, so that reloading the page doesn't repeat the action.
+		http.Redirect(resp, req, req.URL.Path, http.StatusSeeOther)
+		return
+	}
+
+	snapshotsJSON := &snapshotsJSON{
+		CurrentVersion: flagSetStateOf(e.flagSet).version.Load(),
+		UpdatesEnabled: e.updatesEnabled,
+		CSRFToken:      e.csrfToken,
+		Snapshots:      []*snapshotJSON{},
+	}
+	e.snapshotsMu.Lock()
+	for i := len(e.snapshots) - 1; i >= 0; i-- {
+		snapshotsJSON.Snapshots = append(snapshotsJSON.Snapshots, snapshotToJSON(e.flagSet, e.snapshots[i]))
+	}
+	e.snapshotsMu.Unlock()
+
+	if requestIsBrowser(req) && req.URL.Query().Get("format") != "json" {
+		resp.WriteHeader(http.StatusOK)
+		resp.Header().Add("Content-Type", "text/html")
+		if err := flagzSnapshotsTemplate.Execute(resp, snapshotsJSON); err != nil {
+			log.Fatalf("Bad template evaluation: %v", err)
+		}
+	} else {
+		resp.Header().Add("Content-Type", "application/json")
+		out, err := json.MarshalIndent(&snapshotsJSON, "", "  ")
+		if err != nil {
+			resp.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		resp.WriteHeader(http.StatusOK)
+		resp.Write(out)
+	}
+}
+
+type endpointError struct {
+	code int
+	msg  string
+}
+
+func (e *endpointError) Error() string {
+	return e.msg
+}
+
+// checkUpdateAllowed returns an error unless updates are enabled and the `req` carries the `UpdateRequestHeader` or the
+// CSRF token of the endpoint's HTML forms.
+func (e *StatusEndpoint) checkUpdateAllowed(req *http.Request) *endpointError {
+	if !e.updatesEnabled {
+		return &endpointError{http.StatusForbidden, "flagz: updates are not enabled on this endpoint"}
+	}
+	if req.Header.Get(UpdateRequestHeader) != "" {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(req.PostFormValue("csrf_token")), []byte(e.csrfToken)) == 1 {
+		return nil
+	}
+	return &endpointError{http.StatusForbidden, fmt.Sprintf("flagz: updates require a CSRF token or the %v header", UpdateRequestHeader)}
+}
+
+func (e *StatusEndpoint) restoreSnapshot(version string) *endpointError {
+	var snapshot *FlagSetSnapshot
+	e.snapshotsMu.Lock()
+	for _, s := range e.snapshots {
+		if fmt.Sprint(s.Version()) == version {
+			snapshot = s
+		}
+	}
+	e.snapshotsMu.Unlock()
+	if snapshot == nil {
+		return &endpointError{http.StatusNotFound, fmt.Sprintf("flagz: snapshot of version=%v was not found", version)}
+	}
+	if err := Restore(e.flagSet, snapshot); err != nil {
+		return &endpointError{http.StatusBadRequest, err.Error()}
+	}
+	return nil
+}
+
+// SetFlag provides a JSON `http.HandlerFunc` that sets the value of a dynamic Flag. It requires `WithUpdatesEnabled`.
+//
+// It accepts `POST` requests with `flag=<name>` and `value=<value>` form parameters, and an optional `ttl=<duration>`
+// that makes the value a temporary override, see `flagz.SetWithTTL`. Requests must set the `UpdateRequestHeader`. The
+// values are attributed to the `http:<remote address>` source.
+func (e *StatusEndpoint) SetFlag(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(resp, "flagz: only POST requests can set flags", http.StatusMethodNotAllowed)
+		return
+	}
+	f, err := e.setFlag(req)
+	if err != nil {
+		http.Error(resp, err.Error(), err.code)
+		return
+	}
+	resp.Header().Add("Content-Type", "application/json")
+	out, jsonErr := json.MarshalIndent(flagToJSON(f), "", "  ")
+	if jsonErr != nil {
+		resp.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp.WriteHeader(http.StatusOK)
+	resp.Write(out)
+}
+
+// setFlag sets the flag named in the form of the `req`, see `SetFlag`.
+func (e *StatusEndpoint) setFlag(req *http.Request) (*flag.Flag, *endpointError) {
+	if err := e.checkUpdateAllowed(req); err != nil {
+		return nil, err
+	}
+	flagName, value := req.FormValue("flag"), req.FormValue("value")
+	f := e.flagSet.Lookup(flagName)
+	if f == nil || !IsFlagDynamic(f) {
+		return nil, &endpointError{http.StatusNotFound, fmt.Sprintf("flagz: flag=%v is not a dynamic flag", flagName)}
+	}
+	if err := CheckFlagNotFrozen(f); err != nil {
+		return nil, &endpointError{http.StatusConflict, err.Error()}
+	}
+	source := Source("http:" + req.RemoteAddr)
+	var err error
+	if ttlString := req.FormValue("ttl"); ttlString != "" {
+		ttl, parseErr := time.ParseDuration(ttlString)
+		if parseErr != nil {
+			return nil, &endpointError{http.StatusBadRequest, fmt.Sprintf("flagz: bad ttl: %v", parseErr)}
+		}
+		err = SetFromWithTTL(e.flagSet, flagName, value, ttl, source)
+	} else {
+		err = SetFrom(e.flagSet, flagName, value, source)
+	}
+	if err != nil {
+		return nil, &endpointError{http.StatusBadRequest, err.Error()}
+	}
+	return f, nil
+}
+
 func requestIsBrowser(req *http.Request) bool {
 	return strings.Contains(req.Header.Get("Accept"), "html")
 }
@@ -101,6 +336,9 @@ var (
           <div class="panel-heading">
             <code>{{ $flag.Name }}</code>
             {{ if $flag.IsChanged }}<span class="label label-primary">changed</span>{{ end }}
+            {{ if $flag.Override }}<span class="label label-warning">override</span>{{ end }}
+            {{ if $flag.IsFrozen }}<span class="label label-info" title="{{ $flag.FrozenReason }}">frozen</span> <small>{{ $flag.FrozenReason }}</small>{{ end }}
+            {{ if $flag.IsSecret }}<span class="label label-danger">secret</span>{{ end }}
             {{ if $flag.IsDynamic }}
                 <span class="label label-success">dynamic</span>
             {{ else }}
@@ -116,6 +354,128 @@ var (
 			  <dd><pre style="font-size: 8pt">{{ $flag.DefaultValue }}</pre></dd>
 			  <dt>Current</dt>
 			  <dd><pre class="success" style="font-size: 8pt">{{ $flag.CurrentValue }}</pre></dd>
+			  {{ if $flag.AllowedValues }}
+			  <dt>Allowed</dt>
+			  <dd>
+			    {{ if and $.UpdatesEnabled (not $flag.IsFrozen) (not $flag.IsSecret) }}
+			    <form method="POST" class="form-inline" style="display: inline">
+			      <input type="hidden" name="csrf_token" value="{{ $.CSRFToken }}">
+			      <input type="hidden" name="flag" value="{{ $flag.Name }}">
+			      <select name="value" class="input-sm">
+			        {{ range $value := $flag.AllowedValues }}<option{{ if eq $value $flag.CurrentValue }} selected{{ end }}>{{ $value }}</option>{{ end }}
+			      </select>
+			      <button type="submit" class="btn btn-xs btn-primary">Set</button>
+			    </form>
+			    {{ else }}
+			    <small>{{ range $i, $value := $flag.AllowedValues }}{{ if $i }}, {{ end }}<code>{{ $value }}</code>{{ end }}</small>
+			    {{ end }}
+			  </dd>
+			  {{ end }}
+			  {{ if and $.UpdatesEnabled $flag.IsBool (not $flag.IsFrozen) (not $flag.IsSecret) }}
+			  <dt>Toggle</dt>
+			  <dd>
+			    <form method="POST" style="display: inline">
+			      <input type="hidden" name="csrf_token" value="{{ $.CSRFToken }}">
+			      <input type="hidden" name="flag" value="{{ $flag.Name }}">
+			      {{ if eq $flag.CurrentValue "true" }}
+			      <input type="hidden" name="value" value="false"><button type="submit" class="btn btn-xs btn-danger">Turn off</button>
+			      {{ else }}
+			      <input type="hidden" name="value" value="true"><button type="submit" class="btn btn-xs btn-success">Turn on</button>
+			      {{ end }}
+			    </form>
+			  </dd>
+			  {{ end }}
+			  <dt>Source</dt>
+			  <dd><small>{{ $flag.Source }}</small></dd>
+			  {{ if $flag.Override }}
+			  <dt>Override</dt>
+			  <dd><small>expires at {{ $flag.Override.ExpiresAt }} (in {{ $flag.Override.Remaining }}), then reverts to the value from {{ $flag.Override.RevertSource }}:</small></dd>
+			  <dd><pre style="font-size: 8pt">{{ $flag.Override.RevertValue }}</pre></dd>
+			  {{ end }}
+		    </dl>
+		  </div>
+		</div>
+	{{end}}
+</div></div>
+</body>
+</html>
+`))
+)
+
+var (
+	flagzHistoryTemplate = template.Must(template.New("flagz_history").Parse(
+		`
+<html><head>
+<title>Flagz History</title>
+<link href="https://maxcdn.bootstrapcdn.com/bootstrap/3.3.4/css/bootstrap.css" rel="stylesheet">
+
+</head>
+<body>
+<div class="container-fluid">
+<div class="col-md-10 col-md-offset-1">
+	<h1>Flagz History: <code>{{ .Name }}</code></h1>
+	<p>
+	This page presents the latest changes of the flag, newest first (<a href="?flag={{ .Name }}&format=json">JSON</a>).
+	</p>
+
+	<table class="table table-condensed">
+	  <tr><th>Time</th><th>Source</th><th>Old</th><th>New</th><th>Status</th></tr>
+	{{range $entry := .History }}
+	  <tr {{ if $entry.Error }}class="danger"{{ end }}>
+	    <td><small>{{ $entry.Time }}</small></td>
+	    <td><small>{{ $entry.Source }}</small></td>
+	    <td><pre style="font-size: 8pt">{{ $entry.OldValue }}</pre></td>
+	    <td><pre style="font-size: 8pt">{{ $entry.NewValue }}</pre></td>
+	    <td>{{ if $entry.Error }}<span class="label label-danger">rejected</span> <small>{{ $entry.Error }}</small>{{ else }}<span class="label label-success">applied</span>{{ end }}</td>
+	  </tr>
+	{{end}}
+	</table>
+</div></div>
+</body>
+</html>
+`))
+)
+
+var (
+	flagzSnapshotsTemplate = template.Must(template.New("flagz_snapshots").Parse(
+		`
+<html><head>
+<title>Flagz Snapshots</title>
+<link href="https://maxcdn.bootstrapcdn.com/bootstrap/3.3.4/css/bootstrap.css" rel="stylesheet">
+
+</head>
+<body>
+<div class="container-fluid">
+<div class="col-md-10 col-md-offset-1">
+	<h1>Flagz Snapshots</h1>
+	<p>
+	This page presents saved snapshots of the dynamic flags of this server (<a href="?format=json">JSON</a>).
+	The current version is <code>{{ .CurrentVersion }}</code>.
+	</p>
+	{{ if .UpdatesEnabled }}
+	<form method="POST">
+	  <input type="hidden" name="csrf_token" value="{{ .CSRFToken }}">
+	  <button type="submit" class="btn btn-primary">Take snapshot</button>
+	</form>
+	{{ end }}
+
+	{{range $snapshot := .Snapshots }}
+		<div class="panel panel-default">
+		  <div class="panel-heading">
+		    version <code>{{ $snapshot.Version }}</code> <small>{{ $snapshot.Time }}</small>
+		    {{ if $.UpdatesEnabled }}
+		    <form method="POST" action="?restore={{ $snapshot.Version }}" style="display: inline">
+		      <input type="hidden" name="csrf_token" value="{{ $.CSRFToken }}">
+		      <button type="submit" class="btn btn-danger btn-xs">Restore</button>
+		    </form>
+		    {{ end }}
+		  </div>
+		  <div class="panel-body">
+		    <dl class="dl-horizontal" style="margin-bottom: 0px">
+		    {{range $name, $value := $snapshot.Values }}
+			  <dt>{{ $name }}</dt>
+			  <dd><pre style="font-size: 8pt">{{ $value }}</pre></dd>
+		    {{end}}
 		    </dl>
 		  </div>
 		</div>
@@ -129,6 +489,9 @@ var (
 type flagSetJSON struct {
 	ChecksumStatic  string `json:"checksum_static"`
 	ChecksumDynamic string `json:"checksum_dynamic"`
+	UpdatesEnabled  bool   `json:"updates_enabled"`
+	// CSRFToken is sent by the forms of the HTML page.
+	CSRFToken string `json:"-"`
 
 	Flags []*flagJSON `json:"flags"`
 }
@@ -138,9 +501,25 @@ type flagJSON struct {
 	Description  string `json:"description"`
 	CurrentValue string `json:"current_value"`
 	DefaultValue string `json:"default_value"`
+	Source       string `json:"source"`
+	// AllowedValues are the values an enum flag can be set to, see `FlagAllowedValues`.
+	AllowedValues []string `json:"allowed_values,omitempty"`
+
+	IsChanged    bool   `json:"is_changed"`
+	IsDynamic    bool   `json:"is_dynamic"`
+	IsBool       bool   `json:"is_bool"`
+	IsFrozen     bool   `json:"is_frozen"`
+	IsSecret     bool   `json:"is_secret"`
+	FrozenReason string `json:"frozen_reason,omitempty"`
 
-	IsChanged bool `json:"is_changed"`
-	IsDynamic bool `json:"is_dynamic"`
+	Override *overrideJSON `json:"override,omitempty"`
+}
+
+type overrideJSON struct {
+	ExpiresAt    time.Time `json:"expires_at"`
+	Remaining    string    `json:"remaining"`
+	RevertValue  string    `json:"revert_value"`
+	RevertSource string    `json:"revert_source"`
 }
 
 func flagToJSON(f *flag.Flag) *flagJSON {
@@ -149,16 +528,87 @@ func flagToJSON(f *flag.Flag) *flagJSON {
 		Description:  f.Usage,
 		CurrentValue: f.Value.String(),
 		DefaultValue: f.DefValue,
-		IsChanged:    f.Changed,
+		Source:       string(FlagSource(f)),
+		IsChanged:    isFlagChanged(f),
 		IsDynamic:    IsFlagDynamic(f),
+		IsBool:       f.Value.Type() == "dyn_bool",
+	}
+	fj.AllowedValues = FlagAllowedValues(f)
+	fj.FrozenReason, fj.IsFrozen = IsFlagFrozen(f)
+	if override, ok := FlagOverride(f); ok {
+		fj.Override = &overrideJSON{
+			ExpiresAt:    override.ExpiresAt,
+			Remaining:    override.Remaining().Round(time.Second).String(),
+			RevertValue:  override.RevertValue,
+			RevertSource: string(override.RevertSource),
+		}
 	}
 	if strings.Contains(f.Value.Type(), "json") {
 		fj.CurrentValue = prettyPrintJSON(fj.CurrentValue)
 		fj.DefaultValue = prettyPrintJSON(fj.DefaultValue)
+		if fj.Override != nil {
+			fj.Override.RevertValue = prettyPrintJSON(fj.Override.RevertValue)
+		}
+	}
+	fj.IsSecret = IsFlagSecret(f)
+	fj.CurrentValue = RedactFlagValue(f, fj.CurrentValue)
+	fj.DefaultValue = RedactFlagValue(f, fj.DefaultValue)
+	if fj.Override != nil {
+		fj.Override.RevertValue = RedactFlagValue(f, fj.Override.RevertValue)
 	}
 	return fj
 }
 
+type flagHistoryJSON struct {
+	Name    string              `json:"name"`
+	History []*historyEntryJSON `json:"history"`
+}
+
+type historyEntryJSON struct {
+	Time     time.Time `json:"time"`
+	OldValue string    `json:"old_value"`
+	NewValue string    `json:"new_value"`
+	Source   string    `json:"source"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func historyEntryToJSON(entry HistoryEntry) *historyEntryJSON {
+	hj := &historyEntryJSON{
+		Time:     entry.Time,
+		OldValue: entry.OldValue,
+		NewValue: entry.NewValue,
+		Source:   string(entry.Source),
+	}
+	if entry.Err != nil {
+		hj.Error = entry.Err.Error()
+	}
+	return hj
+}
+
+type snapshotsJSON struct {
+	CurrentVersion uint64          `json:"current_version"`
+	UpdatesEnabled bool            `json:"updates_enabled"`
+	CSRFToken      string          `json:"-"`
+	Snapshots      []*snapshotJSON `json:"snapshots"`
+}
+
+type snapshotJSON struct {
+	Version uint64            `json:"version"`
+	Time    time.Time         `json:"time"`
+	Values  map[string]string `json:"values"`
+}
+
+func snapshotToJSON(flagSet *flag.FlagSet, snapshot *FlagSetSnapshot) *snapshotJSON {
+	sj := &snapshotJSON{Version: snapshot.Version(), Time: snapshot.Time(), Values: make(map[string]string)}
+	for _, name := range snapshot.Names() {
+		sj.Values[name] = snapshot.String(name)
+		if f := flagSet.Lookup(name); f != nil {
+			sj.Values[name] = RedactFlagValue(f, sj.Values[name])
+		}
+	}
+	return sj
+}
+
 func prettyPrintJSON(input string) string {
 	out := &bytes.Buffer{}
 	if err := json.Indent(out, []byte(input), "", "  "); err != nil {
@@ -5,9 +5,11 @@ package flagz
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"sort"
+	"strings"
 	"testing"
 
 	flag "github.com/spf13/pflag"
@@ -51,6 +53,11 @@ func (s *endpointTestSuite) TestReturnsOnlyChanged() {
 	req, _ := http.NewRequest("GET", "/debug/flagz?only_changed=true", nil)
 	list := s.processFlagSetJSONResponse(req)
 	s.assertListContainsOnly([]string{"some_static_string", "some_dyn_stringslice"}, list)
+
+	visited := []string{}
+	s.flagSet.Visit(func(f *flag.Flag) { visited = append(visited, f.Name) })
+	assert.ElementsMatch(s.T(), []string{"some_static_string", "some_dyn_stringslice"}, visited, "pflag must see the same changed flags")
+	assert.Equal(s.T(), 2, s.flagSet.NFlag())
 }
 
 func (s *endpointTestSuite) TestReturnsOnlyStatic() {
@@ -87,6 +94,7 @@ func (s *endpointTestSuite) TestCorrectlyRepresentsResources() {
 			Description:  "Some static int text",
 			CurrentValue: "3.14",
 			DefaultValue: "3.14",
+			Source:       "default",
 			IsChanged:    false,
 			IsDynamic:    false,
 		},
@@ -99,6 +107,7 @@ func (s *endpointTestSuite) TestCorrectlyRepresentsResources() {
 			Description:  "Some dynamic slice text",
 			CurrentValue: "[car star]",
 			DefaultValue: "[foo bar]",
+			Source:       "command line",
 			IsChanged:    true,
 			IsDynamic:    true,
 		},
@@ -107,6 +116,15 @@ func (s *endpointTestSuite) TestCorrectlyRepresentsResources() {
 	)
 }
 
+func (s *endpointTestSuite) TestReportsSourceOfSetFrom() {
+	require.NoError(s.T(), SetFrom(s.flagSet, "some_dyn_json", `{"string": "bar", "json": 1}`, FileSource("/etc/flagz/some_dyn_json")))
+
+	req, _ := http.NewRequest("GET", "/debug/flagz", nil)
+	f := findFlagInFlagSetJSON("some_dyn_json", s.processFlagSetJSONResponse(req))
+	assert.Equal(s.T(), "file:/etc/flagz/some_dyn_json", f.Source, "must report the source the flag was set from")
+	assert.True(s.T(), f.IsChanged, "flags set from a source must be reported as changed")
+}
+
 func (s *endpointTestSuite) TestServesHTML() {
 	req, _ := http.NewRequest("GET", "/debug/flagz", nil)
 	req.Header.Add("Accept", "application/xhtml+xml")
@@ -120,6 +138,282 @@ func (s *endpointTestSuite) TestServesHTML() {
 	assert.Contains(s.T(), out, "some_dyn_stringslice")
 }
 
+func (s *endpointTestSuite) TestFlagHistory() {
+	req, _ := http.NewRequest("GET", "/debug/flagz/history?flag=some_dyn_stringslice", nil)
+	resp := httptest.NewRecorder()
+	s.endpoint.FlagHistory(resp, req)
+	require.Equal(s.T(), http.StatusOK, resp.Code, "flagz history request must return 200 OK")
+	require.Equal(s.T(), "application/json", resp.Header().Get("Content-Type"), "type must be indicated")
+	ret := &flagHistoryJSON{}
+	require.NoError(s.T(), json.Unmarshal(resp.Body.Bytes(), ret), "unmarshaling JSON response must succeed")
+	require.Len(s.T(), ret.History, 1, "must contain the change made in setup")
+	assert.Equal(s.T(), "[foo bar]", ret.History[0].OldValue)
+	assert.Equal(s.T(), "[car star]", ret.History[0].NewValue)
+	assert.Empty(s.T(), ret.History[0].Error)
+}
+
+func (s *endpointTestSuite) TestFlagHistoryServesHTML() {
+	s.flagSet.Set("some_dyn_stringslice", `"unterminated`)
+	req, _ := http.NewRequest("GET", "/debug/flagz/history?flag=some_dyn_stringslice", nil)
+	req.Header.Add("Accept", "application/xhtml+xml")
+	resp := httptest.NewRecorder()
+	s.endpoint.FlagHistory(resp, req)
+	require.Equal(s.T(), http.StatusOK, resp.Code, "flagz history request must return 200 OK")
+	out := resp.Body.String()
+	assert.Contains(s.T(), out, "<html>")
+	assert.Contains(s.T(), out, "rejected")
+}
+
+func (s *endpointTestSuite) TestFlagHistoryNotFoundForStaticFlags() {
+	req, _ := http.NewRequest("GET", "/debug/flagz/history?flag=some_static_string", nil)
+	resp := httptest.NewRecorder()
+	s.endpoint.FlagHistory(resp, req)
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code, "static flags have no history")
+}
+
+func (s *endpointTestSuite) TestSnapshotsTakeAndRestore() {
+	s.endpoint.WithUpdatesEnabled()
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/debug/flagz/snapshots", nil)
+	req.Header.Set(UpdateRequestHeader, "1")
+	s.endpoint.Snapshots(resp, req)
+	require.Equal(s.T(), http.StatusSeeOther, resp.Code, "taking a snapshot must redirect back")
+
+	list := s.processSnapshotsJSONResponse()
+	require.Len(s.T(), list.Snapshots, 1, "the snapshot must be listed")
+	assert.Equal(s.T(), "[car star]", list.Snapshots[0].Values["some_dyn_stringslice"])
+	assert.NotContains(s.T(), list.Snapshots[0].Values, "some_static_string", "snapshots must contain only dynamic flags")
+
+	require.NoError(s.T(), s.flagSet.Set("some_dyn_stringslice", "yolo"))
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/debug/flagz/snapshots?restore=%d", list.Snapshots[0].Version), nil)
+	req.Header.Set(UpdateRequestHeader, "1")
+	s.endpoint.Snapshots(resp, req)
+	require.Equal(s.T(), http.StatusSeeOther, resp.Code, "restoring a snapshot must redirect back")
+	assert.Equal(s.T(), "[car star]", s.flagSet.Lookup("some_dyn_stringslice").Value.String(), "flag must be restored")
+}
+
+func (s *endpointTestSuite) TestSnapshotsRefuseRestoringFrozenFlags() {
+	s.endpoint.WithUpdatesEnabled()
+	s.endpoint.snapshots = append(s.endpoint.snapshots, Snapshot(s.flagSet))
+	require.NoError(s.T(), s.flagSet.Set("some_dyn_stringslice", "foo"))
+	require.NoError(s.T(), Freeze(s.flagSet, "some_dyn_stringslice", "release freeze"))
+
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/debug/flagz/snapshots?restore=%d", s.endpoint.snapshots[0].Version()), nil)
+	req.Header.Set(UpdateRequestHeader, "1")
+	resp := httptest.NewRecorder()
+	s.endpoint.Snapshots(resp, req)
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code, "restoring a frozen flag must fail")
+	assert.Equal(s.T(), "[foo]", s.flagSet.Lookup("some_dyn_stringslice").Value.String(), "frozen flag must not be restored")
+}
+
+func (s *endpointTestSuite) TestSnapshotsRequireUpdatesEnabled() {
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/debug/flagz/snapshots", nil)
+	req.Header.Set(UpdateRequestHeader, "1")
+	s.endpoint.Snapshots(resp, req)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code, "taking snapshots must be forbidden without updates enabled")
+	assert.Empty(s.T(), s.processSnapshotsJSONResponse().Snapshots, "no snapshot must be taken")
+
+	s.endpoint.snapshots = append(s.endpoint.snapshots, Snapshot(s.flagSet))
+	list := s.processSnapshotsJSONResponse()
+	require.Len(s.T(), list.Snapshots, 1, "the snapshot must be listed")
+	assert.False(s.T(), list.UpdatesEnabled)
+
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/debug/flagz/snapshots?restore=%d", list.Snapshots[0].Version), nil)
+	req.Header.Set(UpdateRequestHeader, "1")
+	s.endpoint.Snapshots(resp, req)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code, "restoring must be forbidden without updates enabled")
+}
+
+func (s *endpointTestSuite) TestSetFlagWithTTLShowsOverride() {
+	s.endpoint.WithUpdatesEnabled()
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/debug/flagz/set", strings.NewReader("flag=some_dyn_stringslice&value=yolo&ttl=1h"))
+	req.Header.Set(UpdateRequestHeader, "1")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = "10.0.0.1:1234"
+	s.endpoint.SetFlag(resp, req)
+	require.Equal(s.T(), http.StatusOK, resp.Code, "setting a flag must succeed: %v", resp.Body.String())
+
+	req, _ = http.NewRequest("GET", "/debug/flagz", nil)
+	f := findFlagInFlagSetJSON("some_dyn_stringslice", s.processFlagSetJSONResponse(req))
+	assert.Equal(s.T(), "[yolo]", f.CurrentValue)
+	assert.Equal(s.T(), "http:10.0.0.1:1234", f.Source)
+	require.NotNil(s.T(), f.Override, "override must be listed")
+	assert.Equal(s.T(), "[car star]", f.Override.RevertValue)
+	assert.Equal(s.T(), "command line", f.Override.RevertSource)
+	assert.Equal(s.T(), "1h0m0s", f.Override.Remaining)
+}
+
+func (s *endpointTestSuite) TestSetFlagRequiresUpdatesEnabled() {
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/debug/flagz/set?flag=some_dyn_stringslice&value=yolo", nil)
+	req.Header.Set(UpdateRequestHeader, "1")
+	s.endpoint.SetFlag(resp, req)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code, "setting must be forbidden without updates enabled")
+
+	s.endpoint.WithUpdatesEnabled()
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/debug/flagz/set?flag=some_static_string&value=yolo", nil)
+	req.Header.Set(UpdateRequestHeader, "1")
+	s.endpoint.SetFlag(resp, req)
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code, "static flags can't be set")
+}
+
+func (s *endpointTestSuite) TestFrozenFlagsAreListedAndCantBeSet() {
+	s.endpoint.WithUpdatesEnabled()
+	require.NoError(s.T(), Freeze(s.flagSet, "some_dyn_stringslice", "investigating outage"))
+
+	req, _ := http.NewRequest("GET", "/debug/flagz", nil)
+	f := findFlagInFlagSetJSON("some_dyn_stringslice", s.processFlagSetJSONResponse(req))
+	assert.True(s.T(), f.IsFrozen)
+	assert.Equal(s.T(), "investigating outage", f.FrozenReason)
+
+	resp := httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/debug/flagz/set?flag=some_dyn_stringslice&value=yolo", nil)
+	req.Header.Set(UpdateRequestHeader, "1")
+	s.endpoint.SetFlag(resp, req)
+	assert.Equal(s.T(), http.StatusConflict, resp.Code, "frozen flags can't be set")
+	assert.Contains(s.T(), resp.Body.String(), "investigating outage")
+}
+
+func (s *endpointTestSuite) TestSecretFlagsAreRedacted() {
+	MarkFlagSecret(s.flagSet.Lookup("some_dyn_stringslice"))
+	require.NoError(s.T(), s.flagSet.Set("some_dyn_stringslice", "hunter2"))
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/flagz", nil)
+	s.endpoint.ListFlags(resp, req)
+	assert.NotContains(s.T(), resp.Body.String(), "hunter2", "secret values must not be listed")
+	f := findFlagInFlagSetJSON("some_dyn_stringslice", s.processFlagSetJSONResponse(req))
+	assert.True(s.T(), f.IsSecret)
+	assert.Equal(s.T(), RedactedValue, f.CurrentValue)
+	assert.Equal(s.T(), RedactedValue, f.DefaultValue)
+
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/debug/flagz/history?flag=some_dyn_stringslice", nil)
+	s.endpoint.FlagHistory(resp, req)
+	assert.NotContains(s.T(), resp.Body.String(), "hunter2", "secret values must not be in the history")
+
+	s.endpoint.WithUpdatesEnabled()
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/debug/flagz/snapshots", nil)
+	req.Header.Set(UpdateRequestHeader, "1")
+	s.endpoint.Snapshots(resp, req)
+	list := s.processSnapshotsJSONResponse()
+	require.Len(s.T(), list.Snapshots, 1, "the snapshot must be listed")
+	assert.Equal(s.T(), RedactedValue, list.Snapshots[0].Values["some_dyn_stringslice"])
+}
+
+func (s *endpointTestSuite) TestBoolFlagsCanBeToggled() {
+	killSwitch := DynBool(s.flagSet, "some_dyn_bool", false, "Some dynamic bool text")
+
+	req, _ := http.NewRequest("GET", "/debug/flagz", nil)
+	req.Header.Add("Accept", "application/xhtml+xml")
+	resp := httptest.NewRecorder()
+	s.endpoint.ListFlags(resp, req)
+	assert.NotContains(s.T(), resp.Body.String(), "Turn on", "toggles must not be rendered without updates enabled")
+
+	s.endpoint.WithUpdatesEnabled()
+	resp = httptest.NewRecorder()
+	s.endpoint.ListFlags(resp, req)
+	assert.Contains(s.T(), resp.Body.String(), "Turn on", "toggle must be rendered with updates enabled")
+	assert.Contains(s.T(), resp.Body.String(), s.endpoint.csrfToken, "toggle must carry the CSRF token")
+
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/debug/flagz?type=dynamic", strings.NewReader("flag=some_dyn_bool&value=true"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.endpoint.ListFlags(resp, req)
+	require.Equal(s.T(), http.StatusForbidden, resp.Code, "toggling without a CSRF token must be forbidden")
+	assert.False(s.T(), killSwitch.Get(), "flag must not be toggled without a CSRF token")
+
+	resp = httptest.NewRecorder()
+	form := "csrf_token=" + s.endpoint.csrfToken + "&flag=some_dyn_bool&value=true"
+	req, _ = http.NewRequest("POST", "/debug/flagz?type=dynamic", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.endpoint.ListFlags(resp, req)
+	require.Equal(s.T(), http.StatusSeeOther, resp.Code, "toggling must redirect back: %v", resp.Body.String())
+	assert.Equal(s.T(), "/debug/flagz?type=dynamic", resp.Header().Get("Location"))
+	assert.True(s.T(), killSwitch.Get(), "flag must be toggled")
+
+	req, _ = http.NewRequest("GET", "/debug/flagz", nil)
+	f := findFlagInFlagSetJSON("some_dyn_bool", s.processFlagSetJSONResponse(req))
+	assert.True(s.T(), f.IsBool)
+	assert.Equal(s.T(), "true", f.CurrentValue)
+}
+
+func (s *endpointTestSuite) TestEnumFlagsListAllowedValues() {
+	enumFlag := DynEnum(s.flagSet, "some_dyn_enum", []string{"allow", "deny"}, "allow", "Some dynamic enum text")
+
+	req, _ := http.NewRequest("GET", "/debug/flagz", nil)
+	f := findFlagInFlagSetJSON("some_dyn_enum", s.processFlagSetJSONResponse(req))
+	assert.Equal(s.T(), []string{"allow", "deny"}, f.AllowedValues)
+
+	s.endpoint.WithUpdatesEnabled()
+	req.Header.Add("Accept", "application/xhtml+xml")
+	resp := httptest.NewRecorder()
+	s.endpoint.ListFlags(resp, req)
+	assert.Contains(s.T(), resp.Body.String(), "<option selected>allow</option><option>deny</option>", "dropdown must be rendered")
+	assert.Contains(s.T(), resp.Body.String(), s.endpoint.csrfToken, "dropdown must carry the CSRF token")
+
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/debug/flagz", strings.NewReader("flag=some_dyn_enum&value=deny"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.endpoint.ListFlags(resp, req)
+	require.Equal(s.T(), http.StatusForbidden, resp.Code, "selecting without a CSRF token must be forbidden")
+	assert.Equal(s.T(), "allow", enumFlag.Get())
+
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/debug/flagz", strings.NewReader("csrf_token="+s.endpoint.csrfToken+"&flag=some_dyn_enum&value=deny"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.endpoint.ListFlags(resp, req)
+	require.Equal(s.T(), http.StatusSeeOther, resp.Code, "selecting must redirect back: %v", resp.Body.String())
+	assert.Equal(s.T(), "deny", enumFlag.Get())
+}
+
+func (s *endpointTestSuite) TestUpdatesRequireHeaderOrCSRFToken() {
+	s.endpoint.WithUpdatesEnabled()
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/debug/flagz/set?flag=some_dyn_stringslice&value=yolo", nil)
+	s.endpoint.SetFlag(resp, req)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code, "setting must be forbidden without the header")
+
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/debug/flagz/set", strings.NewReader("csrf_token=bad&flag=some_dyn_stringslice&value=yolo"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.endpoint.SetFlag(resp, req)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code, "setting must be forbidden with a bad CSRF token")
+
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/debug/flagz/snapshots", nil)
+	s.endpoint.Snapshots(resp, req)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code, "taking snapshots must be forbidden without the header")
+	assert.Equal(s.T(), "[car star]", s.flagSet.Lookup("some_dyn_stringslice").Value.String(), "flag must not change")
+}
+
+func (s *endpointTestSuite) TestHTMLIsEscaped() {
+	DynString(s.flagSet, "some_dyn_string", "<b>bold</b>", "Some <script>alert(1)</script> text")
+	req, _ := http.NewRequest("GET", "/debug/flagz", nil)
+	req.Header.Add("Accept", "application/xhtml+xml")
+	resp := httptest.NewRecorder()
+	s.endpoint.ListFlags(resp, req)
+	assert.NotContains(s.T(), resp.Body.String(), "<script>alert(1)</script>", "usage must be escaped")
+	assert.NotContains(s.T(), resp.Body.String(), "<b>bold</b>", "values must be escaped")
+	assert.Contains(s.T(), resp.Body.String(), "&lt;b&gt;bold&lt;/b&gt;")
+}
+
+func (s *endpointTestSuite) processSnapshotsJSONResponse() *snapshotsJSON {
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/flagz/snapshots", nil)
+	s.endpoint.Snapshots(resp, req)
+	require.Equal(s.T(), http.StatusOK, resp.Code, "flagz snapshots request must return 200 OK")
+	ret := &snapshotsJSON{}
+	require.NoError(s.T(), json.Unmarshal(resp.Body.Bytes(), ret), "unmarshaling JSON response must succeed")
+	return ret
+}
+
 func (s *endpointTestSuite) processFlagSetJSONResponse(req *http.Request) *flagSetJSON {
 	resp := httptest.NewRecorder()
 	s.endpoint.ListFlags(resp, req)
@@ -31,7 +31,7 @@ var (
 	dynInt = flagz.DynInt64(serverFlags, "example_my_dynamic_int", 1337, "Something integery here.")
 
 	// This is an example of a dynamically-modifiable JSON flag of an arbitrary type.
-	dynJson = flagz.DynJSON(
+	dynJson = flagz.DynJSONOf(
 		serverFlags,
 		"example_my_dynamic_json",
 		&exampleConfig{
@@ -97,7 +97,7 @@ func handleDefaultPage(resp http.ResponseWriter, req *http.Request) {
 	resp.WriteHeader(http.StatusOK)
 	resp.Header().Add("Content-Type", "text/html")
 
-	actualJson, _ := dynJson.Get().(*exampleConfig)
+	actualJson := dynJson.Get()
 	err := defaultPage.Execute(resp, map[string]interface{}{
 		"DynString":  dynStr.Get(),
 		"DynInt":     dynInt.Get(),
@@ -66,5 +66,5 @@ func (f *FileReadValue) readFile() error {
 	if err != nil {
 		return err
 	}
-	return f.flagSet.Set(f.parentFlagName, string(data))
+	return SetFrom(f.flagSet, f.parentFlagName, string(data), FileSource(f.filePath))
 }
@@ -19,6 +19,7 @@ func TestFileFlag_ReadsWithADefault(t *testing.T) {
 		&outerJSON{FieldInts: []int{42}, FieldString: "new-value", FieldInner: &innerJSON{FieldBool: false}},
 		dynFlag.Get(),
 		"value must be set after reading from file")
+	assert.Equal(t, FileSource("testdata/fileread_good.json"), FlagSource(set.Lookup("some_json_1")), "source must be the file")
 }
 
 func TestFileFlag_EmptyPathsAreIgnored(t *testing.T) {
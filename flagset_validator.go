@@ -0,0 +1,88 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+
+	flag "github.com/spf13/pflag"
+)
+
+type flagSetValidator struct {
+	names []string
+	fn    func(*FlagSetSnapshot) error
+}
+
+// AddFlagSetValidator adds a function that checks invariants spanning several dynamic flags of the `flagSet`, such as
+// `min_backoff` <= `max_backoff`.
+//
+// The validator runs whenever any of the flags in `names` is about to change, be it through `Set`, `SetFrom` or
+// `ApplyBatch`. It sees a snapshot of all the flags in `names`, with the proposed values in place of the current ones.
+// Any error it returns rejects the whole update, which allows the etcd `Watcher` to roll it back.
+//
+// Updates of the flags in `names` are serialized with respect to each other, so that the invariants can't be broken
+// by concurrent updates.
+func AddFlagSetValidator(flagSet *flag.FlagSet, names []string, validator func(snapshot *FlagSetSnapshot) error) (*HookRegistration, error) {
+	for _, name := range names {
+		f := flagSet.Lookup(name)
+		if f == nil {
+			return nil, fmt.Errorf("flag=%v was not found", name)
+		}
+		if _, ok := f.Value.(anyValue); !ok || !IsFlagDynamic(f) {
+			return nil, fmt.Errorf("flag=%v is not a dynamic flag", name)
+		}
+	}
+	hook := &flagSetValidator{names: append([]string(nil), names...), fn: validator}
+	state := flagSetStateOf(flagSet)
+	state.hooksMu.Lock()
+	state.validators = append(state.validators[:len(state.validators):len(state.validators)], hook)
+	state.hooksMu.Unlock()
+	return &HookRegistration{remove: func() {
+		state.hooksMu.Lock()
+		state.validators = removeHook(state.validators, hook)
+		state.hooksMu.Unlock()
+	}}, nil
+}
+
+// hasValidatorsFor returns whether any flag set validator checks the flag `name`.
+func (s *flagSetState) hasValidatorsFor(name string) bool {
+	s.hooksMu.Lock()
+	validators := s.validators
+	s.hooksMu.Unlock()
+	for _, v := range validators {
+		for _, n := range v.names {
+			if n == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validate runs the flag set validators that check any of the `proposed` values.
+// It must be called with `mu` held, so that the current values of other flags can't change underneath.
+func (s *flagSetState) validate(flagSet *flag.FlagSet, proposed map[string]interface{}) error {
+	s.hooksMu.Lock()
+	validators := s.validators
+	s.hooksMu.Unlock()
+	for _, v := range validators {
+		touched := false
+		snapshot := &FlagSetSnapshot{values: make(map[string]interface{}, len(v.names))}
+		for _, name := range v.names {
+			if val, ok := proposed[name]; ok {
+				snapshot.values[name] = val
+				touched = true
+			} else {
+				snapshot.values[name] = flagSet.Lookup(name).Value.(anyValue).getAny()
+			}
+		}
+		if !touched {
+			continue
+		}
+		if err := v.fn(snapshot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
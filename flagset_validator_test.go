@@ -0,0 +1,74 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func backoffFlagSet(t *testing.T) (*flag.FlagSet, *DynDurationValue, *DynDurationValue, *HookRegistration) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	minBackoff := DynDuration(set, "min_backoff", 1*time.Second, "Use it or lose it")
+	maxBackoff := DynDuration(set, "max_backoff", 10*time.Second, "Use it or lose it")
+	reg, err := AddFlagSetValidator(set, []string{"min_backoff", "max_backoff"}, func(snapshot *FlagSetSnapshot) error {
+		min, max := snapshot.Get("min_backoff").(time.Duration), snapshot.Get("max_backoff").(time.Duration)
+		if min > max {
+			return fmt.Errorf("min_backoff %v must not exceed max_backoff %v", min, max)
+		}
+		return nil
+	})
+	require.NoError(t, err, "adding a flag set validator must succeed")
+	return set, minBackoff, maxBackoff, reg
+}
+
+func TestFlagSetValidator_RejectsSingleUpdates(t *testing.T) {
+	set, minBackoff, maxBackoff, _ := backoffFlagSet(t)
+
+	assert.NoError(t, set.Set("min_backoff", "5s"), "update keeping the invariant must succeed")
+	assert.Error(t, set.Set("min_backoff", "20s"), "update breaking the invariant must fail")
+	assert.Error(t, SetFrom(set, "max_backoff", "1s", SourceCommandLine), "update breaking the invariant must fail")
+	assert.Equal(t, 5*time.Second, minBackoff.Get())
+	assert.Equal(t, 10*time.Second, maxBackoff.Get())
+
+	history := minBackoff.History()
+	require.Len(t, history, 2)
+	assert.True(t, history[1].Rejected(), "rejected update must be recorded")
+}
+
+func TestFlagSetValidator_SeesCombinedBatchState(t *testing.T) {
+	set, minBackoff, maxBackoff, _ := backoffFlagSet(t)
+
+	require.NoError(t, ApplyBatch(set, map[string]string{"min_backoff": "20s", "max_backoff": "30s"}),
+		"batch keeping the invariant must succeed, even if its values don't on their own")
+	assert.Equal(t, 20*time.Second, minBackoff.Get())
+
+	assert.Error(t, ApplyBatch(set, map[string]string{"min_backoff": "40s", "max_backoff": "35s"}), "batch breaking the invariant must fail")
+	assert.Equal(t, 20*time.Second, minBackoff.Get())
+	assert.Equal(t, 30*time.Second, maxBackoff.Get())
+}
+
+func TestFlagSetValidator_Unregister(t *testing.T) {
+	set, minBackoff, _, reg := backoffFlagSet(t)
+	reg.Unregister()
+	assert.NoError(t, set.Set("min_backoff", "20s"), "unregistered validators must not run")
+	assert.Equal(t, 20*time.Second, minBackoff.Get())
+}
+
+func TestFlagSetValidator_RequiresDynamicFlags(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynInt64(set, "some_int_1", 1, "Use it or lose it")
+	set.Int64("some_static_int", 1, "Use it or lose it")
+	noop := func(*FlagSetSnapshot) error { return nil }
+
+	_, err := AddFlagSetValidator(set, []string{"some_int_1", "some_static_int"}, noop)
+	assert.Error(t, err, "static flags can't be validated")
+	_, err = AddFlagSetValidator(set, []string{"some_int_1", "unknown_flag"}, noop)
+	assert.Error(t, err, "unknown flags can't be validated")
+}
@@ -0,0 +1,79 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package grpcoverrides provides gRPC interceptors that populate per-request flag overrides from signed metadata.
+package grpcoverrides
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mwitkow/go-flagz"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataKey is the gRPC metadata key that carries signed flag overrides, see `flagz.SignOverrides`.
+var MetadataKey = strings.ToLower(flagz.OverridesHeader)
+
+// UnaryServerInterceptor returns a new unary server interceptor that serves requests carrying valid overrides signed
+// with the HMAC `key` with the flag overrides in their context, see `flagz.WithOverrides`.
+// Requests with invalid overrides fail with `InvalidArgument`. It panics if the `key` is empty.
+func UnaryServerInterceptor(key []byte) grpc.UnaryServerInterceptor {
+	mustHaveKey(key)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		newCtx, err := overridesContext(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return handler(newCtx, req)
+	}
+}
+
+// StreamServerInterceptor returns a new streaming server interceptor that serves streams carrying valid overrides
+// signed with the HMAC `key` with the flag overrides in their context, see `flagz.WithOverrides`.
+// Streams with invalid overrides fail with `InvalidArgument`. It panics if the `key` is empty.
+func StreamServerInterceptor(key []byte) grpc.StreamServerInterceptor {
+	mustHaveKey(key)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		newCtx, err := overridesContext(stream.Context(), key)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextServerStream{ServerStream: stream, ctx: newCtx})
+	}
+}
+
+// mustHaveKey panics for empty HMAC keys, with which anyone could sign overrides.
+func mustHaveKey(key []byte) {
+	if len(key) == 0 {
+		panic("grpcoverrides: the HMAC key of overrides must not be empty")
+	}
+}
+
+func overridesContext(ctx context.Context, key []byte) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx, nil
+	}
+	values := md.Get(MetadataKey)
+	if len(values) == 0 {
+		return ctx, nil
+	}
+	overrides, err := flagz.VerifyOverrides(key, values[0])
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return flagz.WithOverrides(ctx, overrides), nil
+}
+
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
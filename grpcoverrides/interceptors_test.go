@@ -0,0 +1,58 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package grpcoverrides_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/grpcoverrides"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var testKey = []byte("some_secret_key")
+
+func TestUnaryServerInterceptor_PopulatesOverrides(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	someInt := flagz.DynInt64(set, "some_int_1", 1, "Use it or lose it")
+	header, err := flagz.SignOverrides(testKey, map[string]string{"some_int_1": "2"}, time.Minute)
+	require.NoError(t, err)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(grpcoverrides.MetadataKey, header))
+	var seen int64
+	_, err = grpcoverrides.UnaryServerInterceptor(testKey)(ctx, nil, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			seen = someInt.GetCtx(ctx)
+			return nil, nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), seen, "handler must see the overridden value")
+	assert.Equal(t, int64(1), someInt.Get(), "global value must not change")
+}
+
+func TestUnaryServerInterceptor_RejectsBadSignatures(t *testing.T) {
+	header, err := flagz.SignOverrides([]byte("other_key"), map[string]string{"some_int_1": "2"}, time.Minute)
+	require.NoError(t, err)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(grpcoverrides.MetadataKey, header))
+	_, err = grpcoverrides.UnaryServerInterceptor(testKey)(ctx, nil, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			assert.Fail(t, "handler must not be called")
+			return nil, nil
+		})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestInterceptors_PanicOnEmptyKeys(t *testing.T) {
+	assert.Panics(t, func() { grpcoverrides.UnaryServerInterceptor(nil) })
+	assert.Panics(t, func() { grpcoverrides.StreamServerInterceptor([]byte{}) })
+}
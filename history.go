@@ -0,0 +1,141 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	// DefaultHistorySize is the number of changes remembered by each dynamic flag, unless changed with `WithHistorySize`.
+	DefaultHistorySize = 16
+)
+
+// HistoryEntry records a single attempt to change the value of a dynamic flag.
+type HistoryEntry struct {
+	// Time is when the change was applied or rejected.
+	Time time.Time
+	// OldValue is the string representation of the value before the change.
+	OldValue string
+	// NewValue is the string representation of the value after the change, or the rejected input.
+	NewValue string
+	// Source describes what made the change, see `flagz.Source`.
+	Source Source
+	// Err is the reason the change was rejected, or nil if it was applied.
+	Err error
+}
+
+// Rejected returns whether the change was rejected and the flag kept its old value.
+func (h HistoryEntry) Rejected() bool {
+	return h.Err != nil
+}
+
+// history is a bounded ring buffer of the latest changes of a flag.
+type history struct {
+	mu      sync.Mutex
+	entries []HistoryEntry
+	next    int
+	full    bool
+}
+
+func newHistory(size int) *history {
+	return &history{entries: make([]HistoryEntry, size)}
+}
+
+func (h *history) record(entry HistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.entries) == 0 {
+		return
+	}
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+func (h *history) list() []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.full {
+		return append([]HistoryEntry(nil), h.entries[:h.next]...)
+	}
+	ret := make([]HistoryEntry, 0, len(h.entries))
+	ret = append(ret, h.entries[h.next:]...)
+	return append(ret, h.entries[:h.next]...)
+}
+
+// History returns the latest changes of the value, oldest first, including the rejected ones.
+func (d *DynValue[T]) History() []HistoryEntry {
+	return d.history.Load().list()
+}
+
+// WithHistorySize changes the number of latest changes remembered by this flag. Zero disables the history.
+// Changes recorded so far are discarded.
+func (d *DynValue[T]) WithHistorySize(size int) *DynValue[T] {
+	d.history.Store(newHistory(size))
+	return d
+}
+
+func (d *DynValue[T]) recordChange(oldValue T, newValue T, source Source, err error) {
+	d.history.Load().record(HistoryEntry{
+		Time:     time.Now(),
+		OldValue: d.redact(d.codec.Format(oldValue)),
+		NewValue: d.redact(d.codec.Format(newValue)),
+		Source:   source,
+		Err:      err,
+	})
+}
+
+func (d *DynValue[T]) recordRejectedInput(input string, source Source, err error) {
+	d.history.Load().record(HistoryEntry{
+		Time:     time.Now(),
+		OldValue: d.redact(d.String()),
+		NewValue: d.redact(input),
+		Source:   source,
+		Err:      err,
+	})
+}
+
+func (d *DynValue[T]) markSecret() {
+	d.secret.Store(true)
+}
+
+// redact hides the `value` from the history if the flag is secret, see `RedactFlagValue`.
+func (d *DynValue[T]) redact(value string) string {
+	if value == "" || !d.secret.Load() {
+		return value
+	}
+	return RedactedValue
+}
+
+// redactErr hides the message of `err` if the flag is secret, since parse and validator errors may quote the value.
+func (d *DynValue[T]) redactErr(err error) error {
+	if err == nil || !d.secret.Load() {
+		return err
+	}
+	return redactedError{err}
+}
+
+type historyValue interface {
+	History() []HistoryEntry
+}
+
+// FlagHistory returns the latest changes of a dynamic flag of the `flagSet`, oldest first.
+func FlagHistory(flagSet *flag.FlagSet, name string) ([]HistoryEntry, error) {
+	f := flagSet.Lookup(name)
+	if f == nil {
+		return nil, fmt.Errorf("flag=%v was not found", name)
+	}
+	hv, ok := f.Value.(historyValue)
+	if !ok || !IsFlagDynamic(f) {
+		return nil, fmt.Errorf("flag=%v doesn't keep history", name)
+	}
+	return hv.History(), nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func historyTransitions(entries []HistoryEntry) []string {
+	ret := []string{}
+	for _, e := range entries {
+		s := fmt.Sprintf("%v->%v", e.OldValue, e.NewValue)
+		if e.Rejected() {
+			s += " rejected"
+		}
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+func TestHistory_RecordsAppliedAndRejectedChanges(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynInt64(set, "some_int_1", 1, "Use it or lose it").WithValidator(ValidateDynInt64Range(0, 100))
+
+	require.NoError(t, set.Set("some_int_1", "2"))
+	require.Error(t, set.Set("some_int_1", "200"))
+	require.Error(t, set.Set("some_int_1", "notanint"))
+	require.NoError(t, set.Set("some_int_1", "3"))
+
+	entries, err := FlagHistory(set, "some_int_1")
+	require.NoError(t, err)
+	assert.Equal(t,
+		[]string{"1->2", "2->200 rejected", "2->notanint rejected", "2->3"},
+		historyTransitions(entries),
+		"history must contain all attempts, oldest first")
+	assert.Contains(t, entries[1].Err.Error(), "not in [0, 100] range", "rejected entries must carry validator errors")
+	for _, e := range entries {
+		assert.False(t, e.Time.IsZero(), "entries must be timestamped")
+	}
+}
+
+func TestHistory_IsBounded(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynInt64(set, "some_int_1", 0, "Use it or lose it")
+	dynFlag.WithHistorySize(3)
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, set.Set("some_int_1", fmt.Sprintf("%d", i)))
+	}
+	assert.Equal(t, []string{"2->3", "3->4", "4->5"}, historyTransitions(dynFlag.History()), "only the latest changes must be kept")
+
+	dynFlag.WithHistorySize(0)
+	require.NoError(t, set.Set("some_int_1", "6"))
+	assert.Empty(t, dynFlag.History(), "zero sized history must not record changes")
+}
+
+func TestFlagHistory_FailsForStaticFlags(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	set.String("some_static_string", "foo", "Use it or lose it")
+	_, err := FlagHistory(set, "some_static_string")
+	assert.Error(t, err)
+	_, err = FlagHistory(set, "unknown_flag")
+	assert.Error(t, err)
+}
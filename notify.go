@@ -0,0 +1,108 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"sync"
+)
+
+// NotifierDelivery specifies how notifiers of a dynamic flag are invoked after its value changes.
+type NotifierDelivery int
+
+const (
+	// DeliverAsync invokes every notifier in a new go-routine for each update.
+	// Two rapid updates may be observed by a notifier out of order.
+	DeliverAsync NotifierDelivery = iota
+	// DeliverOrdered queues updates and delivers them to notifiers one by one, in the order they were applied.
+	// All notifiers of a flag are invoked sequentially from a single worker go-routine that only lives while there are
+	// updates queued.
+	// The queue is bounded, see `WithNotifierQueueSize`: once it is full, its two oldest updates are coalesced into
+	// one, so notifiers still see an unbroken chain of old and new values, but skip some intermediate ones.
+	DeliverOrdered
+	// DeliverLatest is like DeliverOrdered, but coalesces updates when the worker falls behind: only the latest value is
+	// delivered, with the old value being the one that preceded the first of the coalesced updates.
+	DeliverLatest
+)
+
+// DefaultNotifierQueueSize is the number of updates queued for `DeliverOrdered` notifiers of a flag before the oldest
+// ones get coalesced.
+const DefaultNotifierQueueSize = 1024
+
+type pendingChange[T any] struct {
+	oldValue  T
+	newValue  T
+	notifiers []*notifierHook[T]
+}
+
+// deliveryQueue serializes notifier invocations of a single flag.
+type deliveryQueue[T any] struct {
+	mu      sync.Mutex
+	pending []*pendingChange[T]
+	running bool
+	// size is the capacity of `pending`, `DefaultNotifierQueueSize` if 0.
+	size int
+}
+
+func (d *DynValue[T]) notify(delivery NotifierDelivery, notifiers []*notifierHook[T], oldValue T, newValue T) {
+	if len(notifiers) == 0 {
+		return
+	}
+	if delivery == DeliverAsync {
+		for _, n := range notifiers {
+			go n.fn(oldValue, newValue)
+		}
+		return
+	}
+	d.queue.push(&pendingChange[T]{oldValue: oldValue, newValue: newValue, notifiers: notifiers}, delivery == DeliverLatest)
+}
+
+func (q *deliveryQueue[T]) push(change *pendingChange[T], coalesce bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if coalesce && len(q.pending) > 0 {
+		last := q.pending[len(q.pending)-1]
+		last.newValue = change.newValue
+		last.notifiers = change.notifiers
+	} else {
+		q.pending = append(q.pending, change)
+	}
+	size := q.size
+	if size <= 0 {
+		size = DefaultNotifierQueueSize
+	}
+	for len(q.pending) > size {
+		// Coalescing the two oldest updates keeps the queue bounded without breaking the chain of old and new values.
+		q.pending[1].oldValue = q.pending[0].oldValue
+		q.pending[0] = nil
+		q.pending = q.pending[1:]
+	}
+	if !q.running {
+		q.running = true
+		go q.deliver()
+	}
+}
+
+func (q *deliveryQueue[T]) setSize(size int) {
+	q.mu.Lock()
+	q.size = size
+	q.mu.Unlock()
+}
+
+func (q *deliveryQueue[T]) deliver() {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		change := q.pending[0]
+		q.pending[0] = nil
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+		for _, n := range change.notifiers {
+			n.fn(change.oldValue, change.newValue)
+		}
+	}
+}
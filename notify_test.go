@@ -0,0 +1,145 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type deliveredChange struct {
+	oldVal int64
+	newVal int64
+}
+
+func TestNotifierDelivery_OrderedDeliversAllInOrder(t *testing.T) {
+	deliveredCh := make(chan deliveredChange, 200)
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynInt64(set, "some_int_1", 0, "Use it or lose it").WithNotifier(func(oldVal int64, newVal int64) {
+		deliveredCh <- deliveredChange{oldVal, newVal}
+	})
+	dynFlag.WithNotifierDelivery(DeliverOrdered)
+
+	for i := 1; i <= 100; i++ {
+		require.NoError(t, set.Set("some_int_1", fmt.Sprintf("%d", i)))
+	}
+	for i := 1; i <= 100; i++ {
+		select {
+		case <-time.After(100 * time.Millisecond):
+			require.Fail(t, "failed to deliver all notifications")
+		case change := <-deliveredCh:
+			require.Equal(t, deliveredChange{int64(i - 1), int64(i)}, change, "notifications must arrive in order")
+		}
+	}
+}
+
+func TestNotifierDelivery_LatestCoalescesBackedUpUpdates(t *testing.T) {
+	deliveredCh := make(chan deliveredChange, 10)
+	unblockCh := make(chan struct{})
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynInt64(set, "some_int_1", 0, "Use it or lose it").WithNotifier(func(oldVal int64, newVal int64) {
+		deliveredCh <- deliveredChange{oldVal, newVal}
+		<-unblockCh
+	})
+	dynFlag.WithNotifierDelivery(DeliverLatest)
+
+	require.NoError(t, set.Set("some_int_1", "1"))
+	select {
+	case <-time.After(100 * time.Millisecond):
+		require.Fail(t, "failed to deliver first notification")
+	case change := <-deliveredCh:
+		assert.Equal(t, deliveredChange{0, 1}, change)
+	}
+	// The worker is blocked on the first notification, these should be coalesced.
+	require.NoError(t, set.Set("some_int_1", "2"))
+	require.NoError(t, set.Set("some_int_1", "3"))
+	require.NoError(t, set.Set("some_int_1", "4"))
+	close(unblockCh)
+
+	select {
+	case <-time.After(100 * time.Millisecond):
+		require.Fail(t, "failed to deliver coalesced notification")
+	case change := <-deliveredCh:
+		assert.Equal(t, deliveredChange{1, 4}, change, "coalesced notification must span all backed up updates")
+	}
+	select {
+	case <-time.After(10 * time.Millisecond):
+	case change := <-deliveredCh:
+		assert.Fail(t, "no notifications expected after the coalesced one", "got %v", change)
+	}
+}
+
+func TestNotifierDelivery_OrderedInvokesNotifiersSequentially(t *testing.T) {
+	doneCh := make(chan struct{}, 100)
+	inFlight := 0
+	maxInFlight := 0
+	notifier := func(oldVal int64, newVal int64) {
+		// Only safe without locks if the worker invokes notifiers one at a time.
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		time.Sleep(100 * time.Microsecond)
+		inFlight--
+		doneCh <- struct{}{}
+	}
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynInt64(set, "some_int_1", 0, "Use it or lose it").WithNotifier(notifier).WithNotifier(notifier)
+	dynFlag.WithNotifierDelivery(DeliverOrdered)
+
+	for i := 1; i <= 10; i++ {
+		require.NoError(t, set.Set("some_int_1", fmt.Sprintf("%d", i)))
+	}
+	for i := 0; i < 20; i++ {
+		select {
+		case <-time.After(100 * time.Millisecond):
+			require.Fail(t, "failed to deliver all notifications")
+		case <-doneCh:
+		}
+	}
+	assert.Equal(t, 1, maxInFlight, "notifiers must never run concurrently")
+}
+
+func TestNotifierDelivery_OrderedQueueIsBounded(t *testing.T) {
+	deliveredCh := make(chan deliveredChange, 20)
+	unblockCh := make(chan struct{})
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynInt64(set, "some_int_1", 0, "Use it or lose it").WithNotifier(func(oldVal int64, newVal int64) {
+		deliveredCh <- deliveredChange{oldVal, newVal}
+		<-unblockCh
+	})
+	dynFlag.WithNotifierDelivery(DeliverOrdered).WithNotifierQueueSize(3)
+
+	require.NoError(t, set.Set("some_int_1", "1"))
+	select {
+	case <-time.After(100 * time.Millisecond):
+		require.Fail(t, "failed to deliver first notification")
+	case change := <-deliveredCh:
+		assert.Equal(t, deliveredChange{0, 1}, change)
+	}
+	// The worker is blocked on the first notification, so only 3 updates may stay queued.
+	for i := 2; i <= 10; i++ {
+		require.NoError(t, set.Set("some_int_1", fmt.Sprintf("%d", i)))
+	}
+	close(unblockCh)
+
+	for _, expected := range []deliveredChange{{1, 8}, {8, 9}, {9, 10}} {
+		select {
+		case <-time.After(100 * time.Millisecond):
+			require.Fail(t, "failed to deliver queued notifications")
+		case change := <-deliveredCh:
+			assert.Equal(t, expected, change, "oldest queued updates must be coalesced")
+		}
+	}
+	select {
+	case <-time.After(10 * time.Millisecond):
+	case change := <-deliveredCh:
+		assert.Fail(t, "no notifications expected beyond the queue size", "got %v", change)
+	}
+}
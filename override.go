@@ -0,0 +1,207 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// TemporaryOverride describes a value of a dynamic flag set with `SetWithTTL`, that is pending expiry.
+type TemporaryOverride struct {
+	// ExpiresAt is when the flag reverts to `RevertValue`.
+	ExpiresAt time.Time
+	// RevertValue is the string representation of the value the flag reverts to, as last set by its source.
+	RevertValue string
+	// RevertSource is where `RevertValue` came from.
+	RevertSource Source
+}
+
+// Remaining returns how much time is left until the override expires.
+func (o TemporaryOverride) Remaining() time.Duration {
+	return time.Until(o.ExpiresAt)
+}
+
+// Reverts of overrides rejected by validators or commit hooks are retried, with the delay doubling from
+// `overrideRevertRetryMin` up to `overrideRevertRetryMax`, until they succeed or the override is replaced.
+var (
+	overrideRevertRetryMin = 1 * time.Second
+	overrideRevertRetryMax = 1 * time.Minute
+)
+
+type overrideState[T any] struct {
+	base       T
+	baseSource Source
+	expiresAt  time.Time
+	timer      *time.Timer
+	// retryDelay is the delay before the next attempt to revert, after a revert was rejected.
+	retryDelay time.Duration
+}
+
+// SetWithTTL sets the value from a string representation, like `Set`, but only for the given `ttl`.
+//
+// Once the `ttl` passes, the flag reverts to the value it had before, or, if the flag was updated in the meantime, to
+// the value of the latest update. Updates made while the override is active, e.g. by the etcd `Watcher`, don't change
+// the value of the flag, but only the value it will revert to. Setting another override replaces the expiry time.
+func (d *DynValue[T]) SetWithTTL(input string, ttl time.Duration) error {
+	return d.SetFromWithTTL(input, ttl, SourceCommandLine)
+}
+
+// SetFromWithTTL is like `SetWithTTL`, but records `source` as the provenance of the override.
+func (d *DynValue[T]) SetFromWithTTL(input string, ttl time.Duration, source Source) error {
+	if ttl <= 0 {
+		return fmt.Errorf("ttl of an override must be positive, got %v", ttl)
+	}
+	val, err := d.codec.Parse(input)
+	if err != nil {
+		err = d.redactErr(err)
+		d.recordRejectedInput(input, source, err)
+		return err
+	}
+	return d.applyWithTTL(val, source, ttl)
+}
+
+// ClearOverride reverts an active temporary override right away, as if it expired.
+// If the revert is rejected, the override stays active and the revert is retried later.
+func (d *DynValue[T]) ClearOverride() {
+	d.setMu.Lock()
+	o := d.override
+	d.setMu.Unlock()
+	if o != nil {
+		d.revertOverride(o)
+	}
+}
+
+// TemporaryOverride returns the active temporary override of the value, if there's one.
+func (d *DynValue[T]) TemporaryOverride() (TemporaryOverride, bool) {
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	o := d.override
+	if o == nil {
+		return TemporaryOverride{}, false
+	}
+	return TemporaryOverride{ExpiresAt: o.expiresAt, RevertValue: d.codec.Format(o.base), RevertSource: o.baseSource}, true
+}
+
+// installOverride must be called with `setMu` held.
+func (d *DynValue[T]) installOverride(oldValue T, oldSource Source, ttl time.Duration) {
+	base, baseSource := oldValue, oldSource
+	if previous := d.override; previous != nil {
+		previous.timer.Stop()
+		base, baseSource = previous.base, previous.baseSource
+	}
+	o := &overrideState[T]{base: base, baseSource: baseSource, expiresAt: time.Now().Add(ttl)}
+	o.timer = time.AfterFunc(ttl, func() { d.revertOverride(o) })
+	d.override = o
+}
+
+// revertOverride swaps the value the override `o` reverts to back in. If validators or commit hooks reject it, the
+// override stays active, so that it isn't left in place without an expiry, and the revert is retried with a backoff.
+func (d *DynValue[T]) revertOverride(o *overrideState[T]) {
+	if err := d.tryRevertOverride(o); err == nil {
+		return
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.override != o {
+		return
+	}
+	if o.retryDelay == 0 {
+		o.retryDelay = overrideRevertRetryMin
+	}
+	o.timer.Stop()
+	o.timer = time.AfterFunc(o.retryDelay, func() { d.revertOverride(o) })
+	if o.retryDelay *= 2; o.retryDelay > overrideRevertRetryMax {
+		o.retryDelay = overrideRevertRetryMax
+	}
+}
+
+// tryRevertOverride reverts the override `o`, going through the same validators as `applyWithTTL`.
+func (d *DynValue[T]) tryRevertOverride(o *overrideState[T]) error {
+	state := d.setState
+	hasSetValidators := state.hasValidatorsFor(d.flagName)
+	if hasSetValidators {
+		state.commitMu.Lock()
+		defer state.commitMu.Unlock()
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.override != o {
+		// already replaced or reverted
+		return nil
+	}
+	update, err := d.stageValue(o.base, o.baseSource)
+	if err != nil {
+		return err
+	}
+	if hasSetValidators {
+		if err := state.validate(d.flagSet, map[string]interface{}{d.flagName: o.base}); err != nil {
+			err = d.redactErr(err)
+			update.reject(err)
+			return err
+		}
+	}
+	// The override is only dropped once the revert commits, otherwise it would stay in place with no expiry.
+	d.override = nil
+	update.swap()
+	if err := update.commit(update.restore); err != nil {
+		d.override = o
+		return err
+	}
+	o.timer.Stop()
+	update.finish()
+	return nil
+}
+
+// SetWithTTL sets the value of the dynamic flag `name` of the `flagSet` for the given `ttl`, see `DynValue.SetWithTTL`.
+func SetWithTTL(flagSet *flag.FlagSet, name string, value string, ttl time.Duration) error {
+	return SetFromWithTTL(flagSet, name, value, ttl, SourceCommandLine)
+}
+
+// SetFromWithTTL is like `SetWithTTL`, but records `source` as the provenance of the override.
+func SetFromWithTTL(flagSet *flag.FlagSet, name string, value string, ttl time.Duration, source Source) error {
+	f := flagSet.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("flag=%v was not found", name)
+	}
+	overridable, ok := f.Value.(overridableValue)
+	if !ok || !IsFlagDynamic(f) {
+		return fmt.Errorf("flag=%v is not a dynamic flag", name)
+	}
+	if err := overridable.SetFromWithTTL(value, ttl, source); err != nil {
+		return err
+	}
+	markFlagSet(flagSet, f)
+	return nil
+}
+
+// ClearOverride reverts the active temporary override of the dynamic flag `name` of the `flagSet`, if there's one.
+func ClearOverride(flagSet *flag.FlagSet, name string) error {
+	f := flagSet.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("flag=%v was not found", name)
+	}
+	overridable, ok := f.Value.(overridableValue)
+	if !ok || !IsFlagDynamic(f) {
+		return fmt.Errorf("flag=%v is not a dynamic flag", name)
+	}
+	overridable.ClearOverride()
+	return nil
+}
+
+// FlagOverride returns the active temporary override of the flag, if there's one.
+func FlagOverride(f *flag.Flag) (TemporaryOverride, bool) {
+	if overridable, ok := f.Value.(overridableValue); ok && IsFlagDynamic(f) {
+		return overridable.TemporaryOverride()
+	}
+	return TemporaryOverride{}, false
+}
+
+type overridableValue interface {
+	SetFromWithTTL(input string, ttl time.Duration, source Source) error
+	ClearOverride()
+	TemporaryOverride() (TemporaryOverride, bool)
+}
@@ -0,0 +1,134 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetWithTTL_RevertsToPreviousValue(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := killSwitchFlag(set)
+	require.NoError(t, SetFrom(set, "kill_switch", "off", FileSource("/etc/flagz/kill_switch")))
+
+	require.NoError(t, SetWithTTL(set, "kill_switch", "on", 20*time.Millisecond))
+	assert.Equal(t, "on", dynFlag.Get(), "override must be applied right away")
+	override, ok := FlagOverride(set.Lookup("kill_switch"))
+	require.True(t, ok, "override must be pending")
+	assert.Equal(t, "off", override.RevertValue)
+	assert.Equal(t, FileSource("/etc/flagz/kill_switch"), override.RevertSource)
+	assert.True(t, override.Remaining() > 0)
+
+	eventually(t, 1*time.Second, func() bool { return dynFlag.Get() == "off" }, "override must expire")
+	_, ok = FlagOverride(set.Lookup("kill_switch"))
+	assert.False(t, ok, "expired override must not be pending")
+	assert.Equal(t, FileSource("/etc/flagz/kill_switch"), FlagSource(set.Lookup("kill_switch")), "source must be reverted too")
+}
+
+func TestSetWithTTL_RevertsToValueSetInTheMeantime(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := killSwitchFlag(set)
+	notified := make(chan string, 10)
+	dynFlag.WithNotifier(func(oldValue string, newValue string) {
+		notified <- newValue
+	})
+
+	require.NoError(t, SetWithTTL(set, "kill_switch", "on", 30*time.Millisecond))
+	require.NoError(t, ApplyBatch(set, map[string]string{"kill_switch": "maybe"}))
+	assert.Equal(t, "on", dynFlag.Get(), "updates must not replace an active override")
+	override, _ := FlagOverride(set.Lookup("kill_switch"))
+	assert.Equal(t, "maybe", override.RevertValue, "updates must replace the value to revert to")
+
+	eventually(t, 1*time.Second, func() bool { return dynFlag.Get() == "maybe" }, "override must expire")
+	assert.Equal(t, "on", <-notified)
+	assert.Equal(t, "maybe", <-notified, "reverting must trigger notifiers")
+}
+
+func TestClearOverride_RevertsRightAway(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := killSwitchFlag(set)
+	require.NoError(t, SetWithTTL(set, "kill_switch", "on", 1*time.Hour))
+	require.NoError(t, SetWithTTL(set, "kill_switch", "still_on", 1*time.Hour))
+	override, _ := FlagOverride(set.Lookup("kill_switch"))
+	assert.Equal(t, "off", override.RevertValue, "consecutive overrides must revert to the value before the first one")
+
+	require.NoError(t, ClearOverride(set, "kill_switch"))
+	assert.Equal(t, "off", dynFlag.Get())
+	assert.Error(t, SetWithTTL(set, "kill_switch", "on", 0), "overrides must have a positive ttl")
+}
+
+// killSwitchFlag creates a dynamic string flag standing in for a kill switch.
+func killSwitchFlag(set *flag.FlagSet) *DynStringValue {
+	return DynString(set, "kill_switch", "off", "Use it or lose it")
+}
+
+func eventually(t *testing.T, timeout time.Duration, condition func() bool, msg string) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.Fail(t, msg)
+}
+
+func TestSetWithTTL_RetriesRejectedRevert(t *testing.T) {
+	defer func(min time.Duration) { overrideRevertRetryMin = min }(overrideRevertRetryMin)
+	overrideRevertRetryMin = 5 * time.Millisecond
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := killSwitchFlag(set)
+	var ready atomic.Bool
+	var attempts atomic.Int32
+	dynFlag.WithCommitHook(func(oldValue string, newValue string) error {
+		if newValue == "off" && !ready.Load() {
+			attempts.Add(1)
+			return fmt.Errorf("not ready to turn off")
+		}
+		return nil
+	})
+
+	require.NoError(t, SetWithTTL(set, "kill_switch", "on", 5*time.Millisecond))
+	eventually(t, 1*time.Second, func() bool { return attempts.Load() >= 2 }, "vetoed revert must be retried")
+	assert.Equal(t, "on", dynFlag.Get(), "vetoed revert must keep the override value")
+	_, ok := FlagOverride(set.Lookup("kill_switch"))
+	assert.True(t, ok, "vetoed revert must keep the override pending")
+
+	ready.Store(true)
+	eventually(t, 1*time.Second, func() bool { return dynFlag.Get() == "off" }, "revert must be retried until it succeeds")
+	_, ok = FlagOverride(set.Lookup("kill_switch"))
+	assert.False(t, ok, "reverted override must not be pending")
+}
+
+func TestSetWithTTL_RevertIsCheckedByFlagSetValidators(t *testing.T) {
+	defer func(min time.Duration) { overrideRevertRetryMin = min }(overrideRevertRetryMin)
+	overrideRevertRetryMin = 5 * time.Millisecond
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := killSwitchFlag(set)
+	allowOff := DynString(set, "allow_off", "no", "Use it or lose it")
+	_, err := AddFlagSetValidator(set, []string{"kill_switch", "allow_off"}, func(s *FlagSetSnapshot) error {
+		if s.Get("kill_switch") == "off" && s.Get("allow_off") != "yes" {
+			return fmt.Errorf("kill switch can't be turned off yet")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, SetWithTTL(set, "kill_switch", "on", 5*time.Millisecond))
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, "on", dynFlag.Get(), "revert rejected by a flag set validator must keep the override value")
+	history := dynFlag.History()
+	assert.Error(t, history[len(history)-1].Err, "rejected revert must be recorded")
+
+	require.NoError(t, set.Set("allow_off", "yes"))
+	assert.Equal(t, "yes", allowOff.Get())
+	eventually(t, 1*time.Second, func() bool { return dynFlag.Get() == "off" }, "revert must be retried until it is accepted")
+}
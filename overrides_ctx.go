@@ -0,0 +1,181 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OverridesHeader is the HTTP header, and the gRPC metadata key, that carries signed per-request flag overrides.
+const OverridesHeader = "X-Flagz-Overrides"
+
+type overridesKey struct{}
+
+// requestOverrides is the override layer carried by a context. Parsed values are cached per flag, so that each
+// override is only parsed and validated once per request.
+type requestOverrides struct {
+	raw    map[string]string
+	parsed sync.Map
+}
+
+type parsedOverride struct {
+	value interface{}
+	ok    bool
+}
+
+// WithOverrides returns a copy of `ctx` in which the dynamic flags named in `overrides` have different values.
+//
+// The overrides are only visible to code that reads flags with `GetCtx`, and don't change the global state of the
+// flags. Override values are parsed and validated like values passed to `Set`, and those that don't pass are ignored.
+// Overrides of an outer context are kept, unless replaced by `overrides`.
+func WithOverrides(ctx context.Context, overrides map[string]string) context.Context {
+	raw := make(map[string]string, len(overrides))
+	if outer, ok := ctx.Value(overridesKey{}).(*requestOverrides); ok {
+		for name, value := range outer.raw {
+			raw[name] = value
+		}
+	}
+	for name, value := range overrides {
+		raw[name] = value
+	}
+	return context.WithValue(ctx, overridesKey{}, &requestOverrides{raw: raw})
+}
+
+// OverridesFromContext returns the flag overrides carried by `ctx`, see `WithOverrides`.
+func OverridesFromContext(ctx context.Context) map[string]string {
+	overrides, ok := ctx.Value(overridesKey{}).(*requestOverrides)
+	if !ok {
+		return nil
+	}
+	ret := make(map[string]string, len(overrides.raw))
+	for name, value := range overrides.raw {
+		ret[name] = value
+	}
+	return ret
+}
+
+// GetCtx retrieves the value in a thread-safe manner, taking into account overrides carried by `ctx`, see
+// `WithOverrides`.
+func (d *DynValue[T]) GetCtx(ctx context.Context) T {
+	overrides, ok := ctx.Value(overridesKey{}).(*requestOverrides)
+	if !ok {
+		return d.Get()
+	}
+	raw, ok := overrides.raw[d.flagName]
+	if !ok {
+		return d.Get()
+	}
+	cached, ok := overrides.parsed.Load(d)
+	if !ok {
+		cached, _ = overrides.parsed.LoadOrStore(d, d.parseOverride(raw))
+	}
+	if parsed := cached.(parsedOverride); parsed.ok {
+		return parsed.value.(T)
+	}
+	return d.Get()
+}
+
+func (d *DynValue[T]) parseOverride(input string) parsedOverride {
+	val, err := d.codec.Parse(input)
+	if err != nil {
+		return parsedOverride{}
+	}
+	d.hooksMu.Lock()
+	validators := d.validators
+	d.hooksMu.Unlock()
+	for _, v := range validators {
+		if err := v.fn(val); err != nil {
+			return parsedOverride{}
+		}
+	}
+	return parsedOverride{value: val, ok: true}
+}
+
+type signedOverrides struct {
+	Overrides map[string]string `json:"overrides"`
+	Expires   int64             `json:"expires"`
+}
+
+// errEmptyOverridesKey is returned for empty HMAC keys, with which anyone could sign overrides.
+var errEmptyOverridesKey = fmt.Errorf("flagz: the HMAC key of overrides must not be empty")
+
+// SignOverrides encodes `overrides` as a value of the `OverridesHeader`, signed with the HMAC `key` and valid for
+// the given `ttl`. The `key` must not be empty.
+func SignOverrides(key []byte, overrides map[string]string, ttl time.Duration) (string, error) {
+	if len(key) == 0 {
+		return "", errEmptyOverridesKey
+	}
+	payload, err := json.Marshal(&signedOverrides{Overrides: overrides, Expires: time.Now().Add(ttl).Unix()})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + hex.EncodeToString(overridesMAC(key, encoded)), nil
+}
+
+// VerifyOverrides decodes a value of the `OverridesHeader`, checking that it was signed with the HMAC `key` and that
+// it hasn't expired. The `key` must not be empty.
+func VerifyOverrides(key []byte, header string) (map[string]string, error) {
+	if len(key) == 0 {
+		return nil, errEmptyOverridesKey
+	}
+	parts := strings.Split(header, ".")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("flagz: malformed overrides header")
+	}
+	signature, err := hex.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, overridesMAC(key, parts[0])) {
+		return nil, fmt.Errorf("flagz: bad signature of overrides header")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("flagz: malformed overrides header: %v", err)
+	}
+	signed := &signedOverrides{}
+	if err := json.Unmarshal(payload, signed); err != nil {
+		return nil, fmt.Errorf("flagz: malformed overrides header: %v", err)
+	}
+	if time.Now().Unix() > signed.Expires {
+		return nil, fmt.Errorf("flagz: overrides header expired")
+	}
+	return signed.Overrides, nil
+}
+
+func overridesMAC(key []byte, encoded string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// OverridesMiddleware wraps an `http.Handler`, so that requests carrying a valid `OverridesHeader` signed with the
+// HMAC `key` are served with the flag overrides in their context, see `WithOverrides`.
+// Requests with an invalid header are rejected with `400 Bad Request`. It panics if the `key` is empty.
+func OverridesMiddleware(key []byte, next http.Handler) http.Handler {
+	if len(key) == 0 {
+		panic(errEmptyOverridesKey.Error())
+	}
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		header := req.Header.Get(OverridesHeader)
+		if header == "" {
+			next.ServeHTTP(resp, req)
+			return
+		}
+		overrides, err := VerifyOverrides(key, header)
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(resp, req.WithContext(WithOverrides(req.Context(), overrides)))
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCtx_ConsultsOverridesFirst(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	someInt := DynInt64(set, "some_int_1", 1, "Use it or lose it").WithValidator(ValidateDynInt64Range(0, 100))
+	someString := DynString(set, "some_string_1", "foo", "Use it or lose it")
+
+	ctx := WithOverrides(context.Background(), map[string]string{"some_int_1": "2"})
+	assert.Equal(t, int64(2), someInt.GetCtx(ctx), "overridden flags must return the override")
+	assert.Equal(t, "foo", someString.GetCtx(ctx), "other flags must return the global value")
+	assert.Equal(t, int64(1), someInt.Get(), "overrides must not change the global value")
+	assert.Equal(t, int64(1), someInt.GetCtx(context.Background()))
+
+	nested := WithOverrides(ctx, map[string]string{"some_string_1": "bar"})
+	assert.Equal(t, int64(2), someInt.GetCtx(nested), "overrides of outer contexts must be kept")
+	assert.Equal(t, "bar", someString.GetCtx(nested))
+	assert.Equal(t, map[string]string{"some_int_1": "2", "some_string_1": "bar"}, OverridesFromContext(nested))
+
+	invalid := WithOverrides(context.Background(), map[string]string{"some_int_1": "200"})
+	assert.Equal(t, int64(1), someInt.GetCtx(invalid), "overrides that don't pass validators must be ignored")
+	unparsable := WithOverrides(context.Background(), map[string]string{"some_int_1": "notanint"})
+	assert.Equal(t, int64(1), someInt.GetCtx(unparsable), "overrides that don't parse must be ignored")
+}
+
+func TestVerifyOverrides(t *testing.T) {
+	key := []byte("some_secret_key")
+	header, err := SignOverrides(key, map[string]string{"some_int_1": "2"}, time.Minute)
+	require.NoError(t, err)
+
+	overrides, err := VerifyOverrides(key, header)
+	require.NoError(t, err, "verifying with the right key must succeed")
+	assert.Equal(t, map[string]string{"some_int_1": "2"}, overrides)
+
+	_, err = VerifyOverrides([]byte("other_key"), header)
+	assert.Error(t, err, "verifying with a different key must fail")
+	_, err = VerifyOverrides(key, "garbage")
+	assert.Error(t, err, "malformed headers must fail")
+
+	expired, err := SignOverrides(key, map[string]string{"some_int_1": "2"}, -time.Minute)
+	require.NoError(t, err)
+	_, err = VerifyOverrides(key, expired)
+	assert.Error(t, err, "expired headers must fail")
+}
+
+func TestOverrides_RejectEmptyKeys(t *testing.T) {
+	_, err := SignOverrides(nil, map[string]string{"some_int_1": "2"}, time.Minute)
+	assert.Error(t, err, "signing with an empty key must fail")
+
+	header, err := SignOverrides([]byte("some_secret_key"), map[string]string{"some_int_1": "2"}, time.Minute)
+	require.NoError(t, err)
+	_, err = VerifyOverrides([]byte{}, header)
+	assert.Error(t, err, "verifying with an empty key must fail")
+
+	assert.Panics(t, func() {
+		OverridesMiddleware(nil, http.NotFoundHandler())
+	}, "middleware with an empty key must not be built")
+}
+
+func TestOverridesMiddleware(t *testing.T) {
+	key := []byte("some_secret_key")
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	someInt := DynInt64(set, "some_int_1", 1, "Use it or lose it")
+	var seen int64
+	handler := OverridesMiddleware(key, http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		seen = someInt.GetCtx(req.Context())
+	}))
+
+	header, err := SignOverrides(key, map[string]string{"some_int_1": "2"}, time.Minute)
+	require.NoError(t, err)
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(OverridesHeader, header)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, int64(2), seen, "handler must see the overridden value")
+
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.Header.Set(OverridesHeader, header+"00")
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code, "badly signed overrides must be rejected")
+}
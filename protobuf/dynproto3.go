@@ -5,9 +5,6 @@ package protoflagz
 
 import (
 	"reflect"
-	"sync/atomic"
-	"unsafe"
-
 	"strings"
 
 	"github.com/golang/protobuf/jsonpb"
@@ -25,73 +22,31 @@ func DynProto3(flagSet *flag.FlagSet, name string, value proto.Message, usage st
 	if reflectVal.Kind() != reflect.Ptr || reflectVal.Elem().Kind() != reflect.Struct {
 		panic("DynJSON value must be a pointer to a struct")
 	}
-	dynValue := &DynProto3Value{
-		ptr:        unsafe.Pointer(reflectVal.Pointer()),
-		structType: reflectVal.Type().Elem(),
-		flagSet:    flagSet,
-		flagName:   name,
-	}
+	codec := &proto3Codec{structType: reflectVal.Type().Elem()}
+	dynValue := &DynProto3Value{flagz.NewDynValue[proto.Message](flagSet, name, value, codec)}
 	f := flagSet.VarPF(dynValue, name, "", usage)
 	f.DefValue = dynValue.usageString()
 	flagz.MarkFlagDynamic(f)
 	return dynValue
 }
 
-// DynJSONValue is a flag-related JSON struct value wrapper.
+// DynProto3Value is a flag-related Proto3 struct value wrapper.
 type DynProto3Value struct {
-	structType reflect.Type
-	ptr        unsafe.Pointer
-	validator  func(proto.Message) error
-	notifier   func(oldValue proto.Message, newValue proto.Message)
-	flagName   string
-	flagSet    *flag.FlagSet
-}
-
-// Get retrieves the value in its original JSON struct type in a thread-safe manner.
-func (d *DynProto3Value) Get() proto.Message {
-	return d.unsafeToStoredType(atomic.LoadPointer(&d.ptr)).(proto.Message)
-}
-
-// Set updates the value from a string representation in a thread-safe manner.
-// This operation may return an error if the provided `input` doesn't parse, or the resulting value doesn't pass an
-// optional validator.
-// If a notifier is set on the value, it will be invoked in a separate go-routine.
-func (d *DynProto3Value) Set(input string) error {
-	someStruct := reflect.New(d.structType).Interface().(proto.Message)
-	if strings.HasPrefix(strings.TrimSpace(input), "{") && strings.HasSuffix(strings.TrimSpace(input), "}") {
-		if err := jsonpb.UnmarshalString(input, someStruct); err != nil {
-			return err
-		}
-	} else {
-		if err := proto.Unmarshal([]byte(input), someStruct); err != nil {
-			return err
-		}
-	}
-
-	if d.validator != nil {
-		if err := d.validator(someStruct); err != nil {
-			return err
-		}
-	}
-	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(reflect.ValueOf(someStruct).Pointer()))
-	if d.notifier != nil {
-		go d.notifier(d.unsafeToStoredType(oldPtr).(proto.Message), someStruct)
-	}
-	return nil
+	*flagz.DynValue[proto.Message]
 }
 
 // WithValidator adds a function that checks values before they're set.
 // Any error returned by the validator will lead to the value being rejected.
 // Validators are executed on the same go-routine as the call to `Set`.
 func (d *DynProto3Value) WithValidator(validator func(proto.Message) error) *DynProto3Value {
-	d.validator = validator
+	d.DynValue.WithValidator(validator)
 	return d
 }
 
 // WithNotifier adds a function is called every time a new value is successfully set.
 // Each notifier is executed in a new go-routine.
 func (d *DynProto3Value) WithNotifier(notifier func(oldValue proto.Message, newValue proto.Message)) *DynProto3Value {
-	d.notifier = notifier
+	d.DynValue.WithNotifier(notifier)
 	return d
 }
 
@@ -102,15 +57,10 @@ func (d *DynProto3Value) WithNotifier(notifier func(oldValue proto.Message, newV
 //
 // Flag value reads are subject to notifiers and validators.
 func (d *DynProto3Value) WithFileFlag(defaultPath string) *DynProto3Value {
-	flagz.FileReadFlag(d.flagSet, d.flagName, defaultPath)
+	d.DynValue.WithFileFlag(defaultPath)
 	return d
 }
 
-// Type is an indicator of what this flag represents.
-func (d *DynProto3Value) Type() string {
-	return "dyn_proto3_json"
-}
-
 // PrettyString returns a nicely structured representation of the type.
 // In this case it returns a pretty-printed JSON.
 func (d *DynProto3Value) PrettyString() string {
@@ -122,27 +72,52 @@ func (d *DynProto3Value) PrettyString() string {
 	return string(out)
 }
 
-// String returns the canonical string representation of the type.
-// In this case it returns the JSONPB representation of the object.
-func (d *DynProto3Value) String() string {
+func (d *DynProto3Value) usageString() string {
+	s := d.String()
+	if len(s) > 128 {
+		return "{ ... truncated ... }"
+	} else {
+		return s
+	}
+}
+
+type proto3Codec struct {
+	structType reflect.Type
+}
+
+func (c *proto3Codec) Parse(input string) (proto.Message, error) {
+	someStruct := reflect.New(c.structType).Interface().(proto.Message)
+	if strings.HasPrefix(strings.TrimSpace(input), "{") && strings.HasSuffix(strings.TrimSpace(input), "}") {
+		if err := jsonpb.UnmarshalString(input, someStruct); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := proto.Unmarshal([]byte(input), someStruct); err != nil {
+			return nil, err
+		}
+	}
+	return someStruct, nil
+}
+
+// Format returns the JSONPB representation of the object.
+func (c *proto3Codec) Format(value proto.Message) string {
 	m := &jsonpb.Marshaler{OrigName: true}
-	out, err := m.MarshalToString(d.Get())
+	out, err := m.MarshalToString(value)
 	if err != nil {
 		return "ERR"
 	}
 	return string(out)
 }
 
-func (d *DynProto3Value) usageString() string {
-	s := d.String()
-	if len(s) > 128 {
-		return "{ ... truncated ... }"
-	} else {
-		return s
+// Canonical returns the JSONPB representation of the object, with keys sorted and without whitespace.
+func (c *proto3Codec) Canonical(value proto.Message) string {
+	out, err := flagz.CanonicalJSON([]byte(c.Format(value)))
+	if err != nil {
+		return "ERR"
 	}
+	return out
 }
 
-func (d *DynProto3Value) unsafeToStoredType(p unsafe.Pointer) interface{} {
-	n := reflect.NewAt(d.structType, p)
-	return n.Interface()
+func (c *proto3Codec) Type() string {
+	return "dyn_proto3_json"
 }
@@ -117,3 +117,17 @@ func TestDynProto3_FiresNotifier(t *testing.T) {
 	case <-waitCh:
 	}
 }
+
+func TestDynProto3_CanonicalStringIsEqualForAllEncodings(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	jsonFlag := DynProto3(set, "some_proto3_1", defaultProto3, "Use it or lose it")
+	origNameFlag := DynProto3(set, "some_proto3_2", defaultProto3, "Use it or lose it")
+	protoFlag := DynProto3(set, "some_proto3_3", defaultProto3, "Use it or lose it")
+	require.NoError(t, set.Set("some_proto3_1", someProto3JsonPbValue))
+	require.NoError(t, set.Set("some_proto3_2", someProto3JsonPbOrigValue))
+	require.NoError(t, set.Set("some_proto3_3", string(someProto3Proto)))
+
+	assert.Equal(t, `{"some_enum":"OPT_2","some_map":{"foo":1337},"some_string":"wolololo"}`, jsonFlag.CanonicalString())
+	assert.Equal(t, jsonFlag.CanonicalString(), origNameFlag.CanonicalString())
+	assert.Equal(t, jsonFlag.CanonicalString(), protoFlag.CanonicalString())
+}
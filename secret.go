@@ -0,0 +1,110 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	secretMarker = "__is_secret"
+
+	// RedactedValue replaces values of secret flags wherever flagz would otherwise print them.
+	RedactedValue = "[redacted]"
+)
+
+// MarkFlagSecret marks the flag as holding a secret, such as an API token.
+//
+// Values of secret flags are redacted on the `/debug/flagz` pages, in the logs of updaters and in the history of
+// dynamic flags, and `ChecksumFlagSet` only hashes them with a keyed hash, see `SetChecksumSecretKey`. Errors that
+// reject values of secret dynamic flags leave out the reason, since it may quote the value. Changes recorded in the
+// history before the flag was marked are kept as they were.
+func MarkFlagSecret(f *flag.Flag) {
+	setAnnotation(f, secretMarker, []string{})
+	if sv, ok := f.Value.(secretValue); ok {
+		sv.markSecret()
+	}
+}
+
+// IsFlagSecret returns whether the given Flag has been marked as holding a secret, see `MarkFlagSecret`.
+func IsFlagSecret(f *flag.Flag) bool {
+	_, ok := getAnnotation(f, secretMarker)
+	return ok
+}
+
+// RedactFlagValue returns the `value` of the flag, or `RedactedValue` if the flag is secret.
+// Empty values are returned as they are, so that it's still visible whether a secret is set.
+// It is meant for updaters that log the values they apply.
+func RedactFlagValue(f *flag.Flag, value string) string {
+	if value == "" || !IsFlagSecret(f) {
+		return value
+	}
+	return RedactedValue
+}
+
+// DynSecret creates a `Flag` that represents a secret `string` which is safe to change dynamically at runtime.
+// The flag is marked with `MarkFlagSecret`, and its default value is redacted from the usage message.
+func DynSecret(flagSet *flag.FlagSet, name string, value string, usage string) *DynSecretValue {
+	dynValue := &DynSecretValue{NewDynValue[string](flagSet, name, value, secretCodec{})}
+	flag := flagSet.VarPF(dynValue, name, "", usage)
+	MarkFlagDynamic(flag)
+	MarkFlagSecret(flag)
+	flag.DefValue = RedactFlagValue(flag, flag.DefValue)
+	return dynValue
+}
+
+// DynSecretValue is a flag-related secret `string` value wrapper.
+type DynSecretValue struct {
+	*DynValue[string]
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+// Errors returned by the validator should not include the value, as they are logged by updaters.
+func (d *DynSecretValue) WithValidator(validator func(string) error) *DynSecretValue {
+	d.DynValue.WithValidator(validator)
+	return d
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine.
+func (d *DynSecretValue) WithNotifier(notifier func(oldValue string, newValue string)) *DynSecretValue {
+	d.DynValue.WithNotifier(notifier)
+	return d
+}
+
+type secretValue interface {
+	markSecret()
+}
+
+// redactedError is a rejection of a value of a secret flag. Its message leaves out the original error, which may
+// quote the value, but the original error can still be matched with `errors.Is` and `errors.As`.
+type redactedError struct {
+	err error
+}
+
+func (e redactedError) Error() string {
+	return "value " + RedactedValue + " was rejected"
+}
+
+func (e redactedError) Unwrap() error {
+	return e.err
+}
+
+type secretCodec struct{}
+
+func (secretCodec) Parse(input string) (string, error) {
+	return input, nil
+}
+
+func (secretCodec) Format(value string) string {
+	return fmt.Sprintf("%v", value)
+}
+
+func (secretCodec) Type() string {
+	return "dyn_secret"
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynSecret_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynVal := flagz.DynSecret(set, "some_secret_1", "s3cr3t", "Use it or lose it")
+	f := set.Lookup("some_secret_1")
+	assert.True(t, flagz.IsFlagSecret(f), "DynSecret must be marked as secret")
+	assert.True(t, flagz.IsFlagDynamic(f), "DynSecret must be dynamic")
+	assert.Equal(t, "s3cr3t", dynVal.Get(), "value must be readable")
+	assert.Equal(t, flagz.RedactedValue, f.DefValue, "default value must be redacted")
+	assert.NotContains(t, set.FlagUsages(), "s3cr3t", "usage must not print the default value")
+
+	require.NoError(t, set.Set("some_secret_1", "hunter2"))
+	assert.Equal(t, "hunter2", dynVal.Get(), "value must be set")
+	require.NoError(t, flagz.ResetFlag(set, "some_secret_1"))
+	assert.Equal(t, "s3cr3t", dynVal.Get(), "value must be reset to the real default")
+}
+
+func TestDynSecret_HistoryIsRedacted(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynVal := flagz.DynSecret(set, "some_secret_1", "", "Use it or lose it").
+		WithValidator(func(v string) error {
+			if v == "bad" {
+				return assert.AnError
+			}
+			return nil
+		})
+	require.NoError(t, set.Set("some_secret_1", "hunter2"))
+	require.Error(t, set.Set("some_secret_1", "bad"))
+
+	history := dynVal.History()
+	require.Len(t, history, 2)
+	assert.Equal(t, "", history[0].OldValue, "empty values are not redacted")
+	assert.Equal(t, flagz.RedactedValue, history[0].NewValue)
+	assert.Equal(t, flagz.RedactedValue, history[1].OldValue)
+	assert.Equal(t, flagz.RedactedValue, history[1].NewValue, "rejected inputs must be redacted too")
+}
+
+func TestMarkFlagSecret_RedactsDynString(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	flagz.DynString(set, "some_string_1", "foo", "Use it or lose it")
+	f := set.Lookup("some_string_1")
+	assert.Equal(t, "foo", flagz.RedactFlagValue(f, "foo"), "values of flags that are not secret must be kept")
+
+	flagz.MarkFlagSecret(f)
+	assert.Equal(t, flagz.RedactedValue, flagz.RedactFlagValue(f, "foo"))
+	assert.Equal(t, "", flagz.RedactFlagValue(f, ""), "empty values are not redacted")
+	require.NoError(t, set.Set("some_string_1", "bar"))
+	history, err := flagz.FlagHistory(set, "some_string_1")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, flagz.RedactedValue, history[0].NewValue)
+	assert.Equal(t, "bar", f.Value.String(), "the value itself must not be redacted")
+}
+
+func TestMarkFlagSecret_RedactsRejections(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	errTooShort := errors.New("too short")
+	flagz.DynInt64(set, "some_int_1", 1, "Use it or lose it").WithValidator(func(v int64) error {
+		if v < 1000 {
+			return fmt.Errorf("pin %d is %w", v, errTooShort)
+		}
+		return nil
+	})
+	f := set.Lookup("some_int_1")
+	flagz.MarkFlagSecret(f)
+
+	for _, bad := range []string{"hunter2", "42"} {
+		err := flagz.SetFrom(set, "some_int_1", bad, "test")
+		require.Error(t, err, "%q must be rejected", bad)
+		assert.NotContains(t, err.Error(), bad, "rejections must not quote the secret")
+	}
+	err := flagz.SetFrom(set, "some_int_1", "42", "test")
+	assert.True(t, errors.Is(err, errTooShort), "the reason must still be matched")
+
+	history, err := flagz.FlagHistory(set, "some_int_1")
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	for _, entry := range history {
+		require.Error(t, entry.Err)
+		assert.NotContains(t, entry.Err.Error(), "hunter2", "history must not quote the secret")
+		assert.NotContains(t, entry.Err.Error(), "42", "history must not quote the secret")
+	}
+}
+func TestMarkFlagSecret_RedactsRejectionsOfStaticFlags(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	set.Int64("some_int_1", 1, "Use it or lose it")
+	flagz.MarkFlagSecret(set.Lookup("some_int_1"))
+
+	err := flagz.SetFrom(set, "some_int_1", "hunter2", "test")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "hunter2", "rejections must not quote the secret")
+}
@@ -0,0 +1,120 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// FlagSetSnapshot is an immutable view of the values of dynamic flags of a `FlagSet`.
+type FlagSetSnapshot struct {
+	version uint64
+	time    time.Time
+	values  map[string]interface{}
+	strings map[string]string
+}
+
+// Snapshot returns a point-in-time view of all dynamic flags of the `flagSet`.
+//
+// The snapshot is taken consistently with respect to `ApplyBatch`, so it never contains a half-applied batch. Handlers
+// that read several flags can take a snapshot once, instead of reading each flag separately.
+func Snapshot(flagSet *flag.FlagSet) *FlagSetSnapshot {
+	snapshot := &FlagSetSnapshot{
+		values:  make(map[string]interface{}),
+		strings: make(map[string]string),
+	}
+	state := flagSetStateOf(flagSet)
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	snapshot.version = state.version.Load()
+	snapshot.time = time.Now()
+	flagSet.VisitAll(func(f *flag.Flag) {
+		if value, ok := f.Value.(anyValue); ok && IsFlagDynamic(f) {
+			val := value.getAny()
+			snapshot.values[f.Name] = val
+			snapshot.strings[f.Name] = RedactFlagValue(f, f.Value.String())
+		}
+	})
+	return snapshot
+}
+
+// Restore rolls all dynamic flags of the `flagSet` back to the values of the `snapshot`, as a single `ApplyBatch`.
+//
+// Only flags whose values differ from the snapshot, or that have an active temporary override, are updated, and they
+// are attributed to the `snapshot@<version>` source. Their temporary overrides, see `SetWithTTL`, are cleared. If any
+// of the values is rejected, or any of the flags to update is frozen, no flag changes.
+func Restore(flagSet *flag.FlagSet, snapshot *FlagSetSnapshot) error {
+	if snapshot.strings == nil {
+		return fmt.Errorf("flagz: only snapshots taken with flagz.Snapshot can be restored")
+	}
+	names := []string{}
+	for name, value := range snapshot.values {
+		if f := flagSet.Lookup(name); f != nil {
+			// compared with the unredacted values of secret flags
+			formatted, ok := f.Value.(anyValue).formatAny(value)
+			if _, overridden := FlagOverride(f); ok && formatted == f.Value.String() && !overridden {
+				continue
+			}
+		}
+		names = append(names, name)
+	}
+	source := Source(fmt.Sprintf("snapshot@%d", snapshot.version))
+	return applyBatch(flagSet, names, func(batched batchValue, f *flag.Flag) (stagedUpdate, error) {
+		if err := CheckFlagNotFrozen(f); err != nil {
+			return nil, err
+		}
+		// Values are restored as they are, since not all flag types can parse their string representation.
+		update, err := batched.stageAny(snapshot.values[f.Name], source)
+		if err != nil {
+			return nil, err
+		}
+		update.clearOverride()
+		return update, nil
+	})
+}
+
+// Version identifies the state of the `FlagSet` the snapshot was taken at. It increases with every committed update
+// of a dynamic flag of the `FlagSet`.
+// Snapshots passed to flag set validators have no version.
+func (s *FlagSetSnapshot) Version() uint64 {
+	return s.version
+}
+
+// Time returns when the snapshot was taken.
+func (s *FlagSetSnapshot) Time() time.Time {
+	return s.time
+}
+
+// Names returns the sorted names of the flags in the snapshot.
+func (s *FlagSetSnapshot) Names() []string {
+	names := make([]string, 0, len(s.values))
+	for name := range s.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the value of the flag `name`, e.g. an `int64` for `DynInt64` flags, or nil if the flag is not part of
+// the snapshot.
+func (s *FlagSetSnapshot) Get(name string) interface{} {
+	return s.values[name]
+}
+
+// String returns the string representation of the flag `name`, or an empty string if the flag is not part of the
+// snapshot. Values of secret flags are redacted, see `RedactFlagValue`.
+func (s *FlagSetSnapshot) String(name string) string {
+	return s.strings[name]
+}
+
+// anyValue is implemented by all dynamic values, and allows reading them without knowing their type.
+type anyValue interface {
+	getAny() interface{}
+	// formatAny formats a value returned by `getAny`, and returns false if it's of another type.
+	formatAny(value interface{}) (string, bool)
+}
@@ -0,0 +1,126 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot_IsImmutableAndVersioned(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynInt64(set, "some_int_1", 1, "Use it or lose it")
+	DynString(set, "some_string_1", "foo", "Use it or lose it")
+	set.String("some_static_string", "foo", "Use it or lose it")
+
+	before := Snapshot(set)
+	require.NoError(t, set.Set("some_int_1", "2"))
+	after := Snapshot(set)
+
+	assert.Equal(t, []string{"some_int_1", "some_string_1"}, before.Names(), "snapshots must contain only dynamic flags")
+	assert.Equal(t, int64(1), before.Get("some_int_1"), "snapshots must not change after updates")
+	assert.Equal(t, int64(2), after.Get("some_int_1"))
+	assert.Equal(t, "2", after.String("some_int_1"))
+	assert.Nil(t, after.Get("some_static_string"))
+	assert.True(t, after.Version() > before.Version(), "versions must increase with updates")
+	assert.Equal(t, after.Version(), Snapshot(set).Version(), "versions must not change without updates")
+}
+
+func TestSnapshot_NeverObservesHalfAppliedBatches(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynInt64(set, "rate", 0, "Use it or lose it")
+	DynInt64(set, "burst", 0, "Use it or lose it")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 100; i++ {
+			ApplyBatch(set, map[string]string{"rate": fmt.Sprintf("%d", i), "burst": fmt.Sprintf("%d", i)})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		snapshot := Snapshot(set)
+		assert.Equal(t, snapshot.Get("rate"), snapshot.Get("burst"), "batches must be observed as a whole")
+	}
+	<-done
+}
+
+func TestRestore_RollsBackChangedFlags(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	someInt := DynInt64(set, "some_int_1", 1, "Use it or lose it")
+	someString := DynString(set, "some_string_1", "foo", "Use it or lose it")
+	someString.WithNotifier(func(oldValue string, newValue string) {
+		assert.Fail(t, "unchanged flags must not be restored")
+	})
+
+	snapshot := Snapshot(set)
+	require.NoError(t, set.Set("some_int_1", "2"))
+	require.NoError(t, Restore(set, snapshot), "restoring must succeed")
+	assert.Equal(t, int64(1), someInt.Get(), "changed flags must be restored")
+	assert.Equal(t, Source(fmt.Sprintf("snapshot@%d", snapshot.Version())), FlagSource(set.Lookup("some_int_1")))
+}
+
+func TestRestore_ClearsTemporaryOverrides(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	someInt := DynInt64(set, "some_int_1", 1, "Use it or lose it")
+	otherInt := DynInt64(set, "some_int_2", 1, "Use it or lose it")
+
+	snapshot := Snapshot(set)
+	require.NoError(t, set.Set("some_int_1", "2"))
+	require.NoError(t, SetWithTTL(set, "some_int_1", "7", time.Hour))
+	require.NoError(t, SetWithTTL(set, "some_int_2", "1", time.Hour))
+	require.NoError(t, set.Set("some_int_2", "3"))
+
+	require.NoError(t, Restore(set, snapshot), "restoring must succeed")
+	assert.Equal(t, int64(1), someInt.Get(), "overridden flags must be restored")
+	_, overridden := FlagOverride(set.Lookup("some_int_1"))
+	assert.False(t, overridden, "overrides of restored flags must be cleared")
+	_, overridden = FlagOverride(set.Lookup("some_int_2"))
+	assert.False(t, overridden, "overrides must be cleared even if the value matches the snapshot")
+	assert.Equal(t, int64(1), otherInt.Get())
+	assert.Equal(t, Source(fmt.Sprintf("snapshot@%d", snapshot.Version())), FlagSource(set.Lookup("some_int_2")))
+}
+
+func TestSnapshot_RedactsSecrets(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	secret := DynSecret(set, "some_secret_1", "s3cr3t", "Use it or lose it")
+
+	snapshot := Snapshot(set)
+	assert.Equal(t, RedactedValue, snapshot.String("some_secret_1"), "string values of secret flags must be redacted")
+	assert.Equal(t, "s3cr3t", snapshot.Get("some_secret_1"), "typed values must be kept")
+
+	require.NoError(t, set.Set("some_secret_1", "hunter2"))
+	require.NoError(t, Restore(set, snapshot))
+	assert.Equal(t, "s3cr3t", secret.Get(), "secret flags must be restored")
+	history := secret.History()
+	require.NoError(t, Restore(set, snapshot))
+	assert.Len(t, secret.History(), len(history), "secret flags with unchanged values must not be restored")
+}
+
+func TestRestore_RefusesFrozenFlags(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	someInt := DynInt64(set, "some_int_1", 1, "Use it or lose it")
+	someString := DynString(set, "some_string_1", "foo", "Use it or lose it")
+
+	snapshot := Snapshot(set)
+	require.NoError(t, set.Set("some_int_1", "2"))
+	require.NoError(t, set.Set("some_string_1", "bar"))
+	require.NoError(t, Freeze(set, "some_int_1", "release freeze"))
+
+	err := Restore(set, snapshot)
+	require.Error(t, err, "restoring a frozen flag must fail")
+	assert.Contains(t, err.Error(), "release freeze")
+	assert.Equal(t, int64(2), someInt.Get(), "frozen flags must not be restored")
+	assert.Equal(t, "bar", someString.Get(), "no flag must be restored when any is frozen")
+}
+
+func TestRestore_FailsForValidatorSnapshots(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	assert.Error(t, Restore(set, &FlagSetSnapshot{}), "only snapshots taken with Snapshot can be restored")
+}
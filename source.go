@@ -0,0 +1,131 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"fmt"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	sourceMarker = "__source"
+)
+
+// Source describes where the current value of a flag came from, e.g. `file:/etc/x.json` or `etcd:/flagz/x@1234`.
+type Source string
+
+const (
+	// SourceDefault is the source of flags that still hold the value they were created with.
+	SourceDefault Source = "default"
+	// SourceCommandLine is the source of flags set through `FlagSet.Set` or `Value.Set`, e.g. by `FlagSet.Parse`.
+	SourceCommandLine Source = "command line"
+)
+
+// FileSource returns the `Source` of values read from the file at `path`.
+func FileSource(path string) Source {
+	return Source("file:" + path)
+}
+
+type sourceKey struct{}
+
+// ContextWithSource returns a copy of `ctx` that carries the `source` of updates made with `SetFromContext`.
+func ContextWithSource(ctx context.Context, source Source) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// SourceFromContext returns the `Source` carried by `ctx`, or `SourceCommandLine` if there's none, same as for
+// updates made through `FlagSet.Set`.
+func SourceFromContext(ctx context.Context) Source {
+	if source, ok := ctx.Value(sourceKey{}).(Source); ok {
+		return source
+	}
+	return SourceCommandLine
+}
+
+// SetFrom sets the value of the flag `name` of the `flagSet` and records `source` as its provenance.
+//
+// It behaves like `flagSet.Set`, marking the flag as changed so that it is listed by `FlagSet.Visit`, and is meant to
+// be used by all code that updates flags from outside of the command line, so that `FlagSource` can tell who set each
+// flag.
+func SetFrom(flagSet *flag.FlagSet, name string, value string, source Source) error {
+	f := flagSet.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("flag=%v was not found", name)
+	}
+	if sourced, ok := f.Value.(sourcedValue); ok && IsFlagDynamic(f) {
+		if err := sourced.SetFrom(value, source); err != nil {
+			return err
+		}
+		markFlagSet(flagSet, f)
+		return nil
+	}
+	state := flagSetStateOf(flagSet)
+	state.pflagMu.Lock()
+	err := flagSet.Set(name, value)
+	state.pflagMu.Unlock()
+	if err != nil {
+		if IsFlagSecret(f) {
+			// pflag quotes the value in its errors
+			return redactedError{err}
+		}
+		return err
+	}
+	setAnnotation(f, sourceMarker, []string{string(source)})
+	return nil
+}
+
+// markFlagSet makes `pflag` record the dynamic flag, whose new value was already applied, as set, so that `Changed`,
+// `FlagSet.Visit` and `FlagSet.NFlag` agree with flags set through `FlagSet.Set`.
+//
+// The value is applied first, e.g. as part of an `ApplyBatch`, and only then passed to `FlagSet.Set`, which skips
+// applying it again. This way no validators or commit hooks run while `pflagMu` is held.
+func markFlagSet(flagSet *flag.FlagSet, f *flag.Flag) {
+	sourced, ok := f.Value.(sourcedValue)
+	if !ok {
+		return
+	}
+	state := flagSetStateOf(flagSet)
+	state.pflagMu.Lock()
+	defer state.pflagMu.Unlock()
+	input := f.Value.String()
+	done := sourced.skipSetOf(input)
+	defer done()
+	flagSet.Set(f.Name, input)
+}
+
+// SetFromContext is like `SetFrom`, with the `Source` taken from `ctx`, see `ContextWithSource`.
+func SetFromContext(ctx context.Context, flagSet *flag.FlagSet, name string, value string) error {
+	return SetFrom(flagSet, name, value, SourceFromContext(ctx))
+}
+
+// FlagSource returns where the current value of the flag came from.
+func FlagSource(f *flag.Flag) Source {
+	if sourced, ok := f.Value.(sourcedValue); ok && IsFlagDynamic(f) {
+		return sourced.Source()
+	}
+	if source, ok := getAnnotation(f, sourceMarker); ok && len(source) > 0 {
+		return Source(source[0])
+	}
+	if f.Changed {
+		return SourceCommandLine
+	}
+	return SourceDefault
+}
+
+// isFlagChanged returns whether the flag holds a value other than its default. Unlike the `Changed` field, it is safe to
+// call while updaters change dynamic flags, and it is false again for flags reset with `ResetFlag`.
+func isFlagChanged(f *flag.Flag) bool {
+	if sourced, ok := f.Value.(sourcedValue); ok && IsFlagDynamic(f) {
+		return sourced.Source() != SourceDefault
+	}
+	return f.Changed
+}
+
+type sourcedValue interface {
+	SetFrom(input string, source Source) error
+	Source() Source
+	skipSetOf(input string) (done func())
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetFrom_TracksSourceOfDynamicFlags(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynInt64(set, "some_int_1", 13371337, "Use it or lose it").WithValidator(ValidateDynInt64Range(0, 20000000))
+	assert.Equal(t, SourceDefault, FlagSource(set.Lookup("some_int_1")), "new flags must come from their defaults")
+
+	require.NoError(t, set.Set("some_int_1", "77"))
+	assert.Equal(t, SourceCommandLine, FlagSource(set.Lookup("some_int_1")), "plain Set must be attributed to the command line")
+
+	require.NoError(t, SetFrom(set, "some_int_1", "78", FileSource("/etc/flagz/some_int_1")))
+	assert.Equal(t, int64(78), dynFlag.Get())
+	assert.True(t, set.Lookup("some_int_1").Changed, "SetFrom must mark the flag as changed")
+	assert.Equal(t, Source("file:/etc/flagz/some_int_1"), FlagSource(set.Lookup("some_int_1")))
+
+	require.Error(t, SetFrom(set, "some_int_1", "-1", Source("etcd:/flagz/some_int_1@12")))
+	assert.Equal(t, Source("file:/etc/flagz/some_int_1"), FlagSource(set.Lookup("some_int_1")), "rejected updates must not change the source")
+
+	history := dynFlag.History()
+	require.Len(t, history, 3)
+	assert.Equal(t, Source("etcd:/flagz/some_int_1@12"), history[2].Source, "history must be attributed to the source")
+
+	require.NoError(t, ResetFlag(set, "some_int_1"))
+	assert.Equal(t, SourceDefault, FlagSource(set.Lookup("some_int_1")), "reset flags must come from their defaults")
+}
+
+func TestSetFrom_IsVisibleToPflag(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynInt64(set, "some_int_1", 1, "Use it or lose it")
+	DynInt64(set, "some_int_2", 2, "Use it or lose it")
+	DynInt64(set, "some_int_3", 3, "Use it or lose it")
+	set.String("some_static_string", "foo", "Use it or lose it")
+
+	require.NoError(t, SetFrom(set, "some_int_1", "11", FileSource("/etc/flagz/some_int_1")))
+	require.NoError(t, ApplyBatchFrom(set, map[string]string{"some_int_2": "22"}, nil))
+	require.NoError(t, SetFromWithTTL(set, "some_int_3", "33", time.Minute, SourceCommandLine))
+	require.NoError(t, SetFrom(set, "some_static_string", "bar", FileSource("/etc/flagz/some_static_string")))
+	require.NoError(t, SetFrom(set, "some_int_1", "111", FileSource("/etc/flagz/some_int_1")))
+
+	visited := []string{}
+	set.Visit(func(f *flag.Flag) { visited = append(visited, f.Name) })
+	assert.Equal(t, []string{"some_int_1", "some_int_2", "some_int_3", "some_static_string"}, visited, "flags set by updaters must be visited")
+	assert.Equal(t, 4, set.NFlag(), "flags set by updaters must be counted once")
+	assert.Equal(t, int64(111), set.Lookup("some_int_1").Value.(*DynInt64Value).Get(), "values must be applied once")
+
+	require.NoError(t, ResetFlag(set, "some_int_1"))
+	assert.Equal(t, 4, set.NFlag(), "reset flags stay recorded as set by pflag")
+	assert.Equal(t, SourceDefault, FlagSource(set.Lookup("some_int_1")))
+}
+
+func TestSetFrom_TracksSourceOfStaticFlags(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	set.String("some_static_string", "foo", "Use it or lose it")
+	set.String("some_other_string", "foo", "Use it or lose it")
+	require.NoError(t, set.Parse([]string{"--some_other_string=bar"}))
+
+	require.NoError(t, SetFrom(set, "some_static_string", "bar", FileSource("/etc/flagz/some_static_string")))
+	assert.Equal(t, Source("file:/etc/flagz/some_static_string"), FlagSource(set.Lookup("some_static_string")))
+	assert.Equal(t, SourceCommandLine, FlagSource(set.Lookup("some_other_string")))
+	assert.Error(t, SetFrom(set, "unknown_flag", "bar", SourceCommandLine), "unknown flags must fail")
+}
+
+func TestSetFromContext_UsesSourceOfContext(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynString(set, "some_string_1", "foo", "Use it or lose it")
+
+	ctx := ContextWithSource(context.Background(), Source("http:10.0.0.1"))
+	require.NoError(t, SetFromContext(ctx, set, "some_string_1", "bar"))
+	assert.Equal(t, Source("http:10.0.0.1"), FlagSource(set.Lookup("some_string_1")))
+
+	require.NoError(t, SetFromContext(context.Background(), set, "some_string_1", "car"))
+	assert.Equal(t, SourceCommandLine, FlagSource(set.Lookup("some_string_1")), "contexts without a source fall back to the command line")
+}
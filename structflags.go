@@ -0,0 +1,362 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	flag "github.com/spf13/pflag"
+)
+
+const structTagName = "flagz"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// RegisterStruct creates a flag for every field of the struct `cfg` that is tagged with `flagz`, e.g.:
+//
+//	type ServiceConfig struct {
+//		MaxConns int64         `flagz:"name=max_conns,dynamic,usage=maximum number of connections,validate=range(1,100)"`
+//		Timeout  time.Duration `flagz:"dynamic,usage=timeout of backend calls"`
+//		Token    string        `flagz:"dynamic,secret,usage=API token of the backend"`
+//		Region   string        `flagz:"usage=region the service runs in"`
+//	}
+//
+// The tag is a comma-separated list of options, commas inside parentheses don't separate options:
+//   - `name=...` is the name of the flag, by default the field name in snake_case. Names are joined to the `prefix`
+//     with an underscore, unless the prefix is empty.
+//   - `dynamic` creates a dynamic flag, supported for `bool`, `int64`, `float64`, `string`, `time.Duration` and
+//     `[]string`. Other flags are static, and additionally support `int`.
+//   - `secret` marks the flag with `MarkFlagSecret`.
+//   - `usage=...` is the usage of the flag, it can't contain commas.
+//   - `validate=...` adds a validator to a dynamic flag: `range(from,to)` for numbers and durations, and
+//     `regex(expr)` for strings.
+//
+// Fields of struct types tagged with `flagz` are registered recursively, with their name added to the prefix.
+// The current values of fields become the flags' defaults. Static flags are bound to the fields of `cfg` like in
+// `pflag`, but dynamic fields of `cfg` are never updated, they must be read through `StructFlags.Get`.
+//
+// All tags are checked before any flag is registered, so an error leaves the `flagSet` untouched.
+func RegisterStruct[T any](flagSet *flag.FlagSet, prefix string, cfg *T) (*StructFlags[T], error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("flagz: RegisterStruct needs a pointer to a struct, got nil")
+	}
+	v := reflect.ValueOf(cfg).Elem()
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("flagz: RegisterStruct needs a pointer to a struct, got %v", v.Type())
+	}
+	fields, err := parseStructFields(v, nil, prefix)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if seen[f.name] || flagSet.Lookup(f.name) != nil {
+			return nil, fmt.Errorf("flagz: field %v: flag=%v is already defined", f.fieldName, f.name)
+		}
+		seen[f.name] = true
+	}
+	s := &StructFlags[T]{flagSet: flagSet, cfg: cfg}
+	for _, f := range fields {
+		field := v.FieldByIndex(f.index)
+		if !f.dynamic {
+			f.registerStatic(flagSet, field)
+		} else {
+			s.dynamic = append(s.dynamic, structDynamicField{index: f.index, value: f.registerDynamic(flagSet, field)})
+		}
+		if f.secret {
+			MarkFlagSecret(flagSet.Lookup(f.name))
+		}
+	}
+	return s, nil
+}
+
+// StructFlags gives thread-safe access to a struct registered with `RegisterStruct`.
+type StructFlags[T any] struct {
+	flagSet *flag.FlagSet
+	cfg     *T
+	dynamic []structDynamicField
+}
+
+type structDynamicField struct {
+	index []int
+	value anyValue
+}
+
+// Get returns a copy of the struct with the current values of all its flags, which the caller is free to modify.
+// Values of dynamic flags updated together with `ApplyBatch` are either all old or all new.
+func (s *StructFlags[T]) Get() T {
+	var ret T
+	ReadConsistent(s.flagSet, func() {
+		ret = *s.cfg
+		v := reflect.ValueOf(&ret).Elem()
+		for _, f := range s.dynamic {
+			value := f.value.getAny()
+			if items, ok := value.([]string); ok {
+				// values of flags are shared by all readers, but the returned struct belongs to the caller
+				value = append([]string(nil), items...)
+			}
+			v.FieldByIndex(f.index).Set(reflect.ValueOf(value))
+		}
+	})
+	return ret
+}
+
+// structField is a parsed `flagz` tag of a struct field, ready to be registered.
+type structField struct {
+	fieldName string
+	index     []int
+	name      string
+	usage     string
+	dynamic   bool
+	secret    bool
+	validator interface{}
+}
+
+func parseStructFields(v reflect.Value, index []int, prefix string) ([]*structField, error) {
+	fields := []*structField{}
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		tag, ok := sf.Tag.Lookup(structTagName)
+		if !ok || tag == "-" {
+			continue
+		}
+		if !sf.IsExported() {
+			return nil, fmt.Errorf("flagz: field %v: unexported fields can't be flags", sf.Name)
+		}
+		f, err := parseStructTag(sf, tag)
+		if err != nil {
+			return nil, fmt.Errorf("flagz: field %v: %v", sf.Name, err)
+		}
+		f.index = append(append([]int(nil), index...), i)
+		if prefix != "" {
+			f.name = prefix + "_" + f.name
+		}
+		if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+			if f.dynamic || f.secret || f.validator != nil {
+				return nil, fmt.Errorf("flagz: field %v: nested structs only take a name", sf.Name)
+			}
+			nested, err := parseStructFields(v.Field(i), f.index, f.name)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, nested...)
+			continue
+		}
+		if err := checkStructFieldType(f, sf.Type); err != nil {
+			return nil, fmt.Errorf("flagz: field %v: %v", sf.Name, err)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func parseStructTag(sf reflect.StructField, tag string) (*structField, error) {
+	f := &structField{fieldName: sf.Name, name: toSnakeCase(sf.Name)}
+	var validate string
+	for _, option := range splitStructTag(tag) {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "name":
+			f.name = value
+		case "usage":
+			f.usage = value
+		case "dynamic":
+			f.dynamic = true
+		case "secret":
+			f.secret = true
+		case "validate":
+			validate = value
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown option %q", key)
+		}
+	}
+	if f.name == "" {
+		return nil, fmt.Errorf("empty flag name")
+	}
+	if validate != "" {
+		if !f.dynamic {
+			return nil, fmt.Errorf("only dynamic flags can be validated")
+		}
+		validator, err := parseStructValidator(validate, sf.Type)
+		if err != nil {
+			return nil, err
+		}
+		f.validator = validator
+	}
+	return f, nil
+}
+
+// splitStructTag splits the tag at commas that are not inside parentheses.
+func splitStructTag(tag string) []string {
+	options := []string{}
+	depth, start := 0, 0
+	for i, r := range tag {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case r == ',' && depth == 0:
+			options = append(options, strings.TrimSpace(tag[start:i]))
+			start = i + 1
+		}
+	}
+	return append(options, strings.TrimSpace(tag[start:]))
+}
+
+func parseStructValidator(validate string, t reflect.Type) (interface{}, error) {
+	fn, args, ok := strings.Cut(validate, "(")
+	if !ok || !strings.HasSuffix(args, ")") {
+		return nil, fmt.Errorf("malformed validator %q", validate)
+	}
+	args = strings.TrimSuffix(args, ")")
+	switch fn {
+	case "range":
+		from, to, ok := strings.Cut(args, ",")
+		if !ok {
+			return nil, fmt.Errorf("range needs two arguments, got %q", args)
+		}
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		switch {
+		case t == durationType:
+			fromDuration, err1 := time.ParseDuration(from)
+			toDuration, err2 := time.ParseDuration(to)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("bad range of durations %q", args)
+			}
+			return validateDynDurationRange(fromDuration, toDuration), nil
+		case t.Kind() == reflect.Int64:
+			fromInt, err1 := strconv.ParseInt(from, 0, 64)
+			toInt, err2 := strconv.ParseInt(to, 0, 64)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("bad range of integers %q", args)
+			}
+			return ValidateDynInt64Range(fromInt, toInt), nil
+		case t.Kind() == reflect.Float64:
+			fromFloat, err1 := strconv.ParseFloat(from, 64)
+			toFloat, err2 := strconv.ParseFloat(to, 64)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("bad range of floats %q", args)
+			}
+			return ValidateDynFloat64Range(fromFloat, toFloat), nil
+		}
+	case "regex":
+		if t.Kind() == reflect.String {
+			matcher, err := regexp.Compile(args)
+			if err != nil {
+				return nil, fmt.Errorf("bad regex: %v", err)
+			}
+			return ValidateDynStringMatchesRegex(matcher), nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown validator %q", fn)
+	}
+	return nil, fmt.Errorf("validator %v doesn't apply to fields of type %v", fn, t)
+}
+
+func validateDynDurationRange(fromInclusive time.Duration, toInclusive time.Duration) func(time.Duration) error {
+	return func(value time.Duration) error {
+		if value > toInclusive || value < fromInclusive {
+			return fmt.Errorf("value %v not in [%v, %v] range", value, fromInclusive, toInclusive)
+		}
+		return nil
+	}
+}
+
+func checkStructFieldType(f *structField, t reflect.Type) error {
+	switch t {
+	case durationType, reflect.TypeOf([]string(nil)), reflect.TypeOf(int64(0)), reflect.TypeOf(float64(0)), reflect.TypeOf(""), reflect.TypeOf(false):
+		return nil
+	case reflect.TypeOf(int(0)):
+		if !f.dynamic {
+			return nil
+		}
+		return fmt.Errorf("type %v can't be a dynamic flag", t)
+	}
+	return fmt.Errorf("type %v can't be a flag", t)
+}
+
+func (f *structField) registerStatic(flagSet *flag.FlagSet, field reflect.Value) {
+	switch ptr := field.Addr().Interface().(type) {
+	case *time.Duration:
+		flagSet.DurationVar(ptr, f.name, *ptr, f.usage)
+	case *[]string:
+		flagSet.StringSliceVar(ptr, f.name, *ptr, f.usage)
+	case *int64:
+		flagSet.Int64Var(ptr, f.name, *ptr, f.usage)
+	case *float64:
+		flagSet.Float64Var(ptr, f.name, *ptr, f.usage)
+	case *string:
+		flagSet.StringVar(ptr, f.name, *ptr, f.usage)
+	case *bool:
+		flagSet.BoolVar(ptr, f.name, *ptr, f.usage)
+	case *int:
+		flagSet.IntVar(ptr, f.name, *ptr, f.usage)
+	}
+}
+
+func (f *structField) registerDynamic(flagSet *flag.FlagSet, field reflect.Value) anyValue {
+	switch value := field.Interface().(type) {
+	case time.Duration:
+		d := DynDuration(flagSet, f.name, value, f.usage)
+		if validator, ok := f.validator.(func(time.Duration) error); ok {
+			d.WithValidator(validator)
+		}
+		return d
+	case []string:
+		return DynStringSlice(flagSet, f.name, value, f.usage)
+	case bool:
+		return DynBool(flagSet, f.name, value, f.usage)
+	case int64:
+		d := DynInt64(flagSet, f.name, value, f.usage)
+		if validator, ok := f.validator.(func(int64) error); ok {
+			d.WithValidator(validator)
+		}
+		return d
+	case float64:
+		d := DynFloat64(flagSet, f.name, value, f.usage)
+		if validator, ok := f.validator.(func(float64) error); ok {
+			d.WithValidator(validator)
+		}
+		return d
+	case string:
+		if f.secret {
+			d := DynSecret(flagSet, f.name, value, f.usage)
+			if validator, ok := f.validator.(func(string) error); ok {
+				d.WithValidator(validator)
+			}
+			return d
+		}
+		d := DynString(flagSet, f.name, value, f.usage)
+		if validator, ok := f.validator.(func(string) error); ok {
+			d.WithValidator(validator)
+		}
+		return d
+	}
+	panic(fmt.Sprintf("flagz: unchecked type %v of field %v", field.Type(), f.fieldName))
+}
+
+// toSnakeCase converts a Go field name, e.g. `MaxHTTPConns`, to a flag name, e.g. `max_http_conns`.
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	out := make([]rune, 0, len(runes)+4)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (nextLower && unicode.IsUpper(runes[i-1])) {
+				out = append(out, '_')
+			}
+		}
+		out = append(out, unicode.ToLower(r))
+	}
+	return string(out)
+}
@@ -0,0 +1,173 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testBackendConfig struct {
+	Addresses []string      `flagz:"dynamic,usage=addresses of the backend"`
+	Timeout   time.Duration `flagz:"dynamic,validate=range(1ms,10s)"`
+}
+
+type testServiceConfig struct {
+	MaxConns     int64             `flagz:"name=max_conns,dynamic,usage=maximum number of connections,validate=range(1,100)"`
+	Ratio        float64           `flagz:"dynamic"`
+	Mode         string            `flagz:"dynamic,validate=regex(^(fast|slow)$)"`
+	Token        string            `flagz:"dynamic,secret"`
+	Region       string            `flagz:"usage=region the service runs in"`
+	EnableHTTP2  bool              `flagz:""`
+	Backend      testBackendConfig `flagz:"name=backend"`
+	NotAFlag     int
+	AlsoNotAFlag string `flagz:"-"`
+}
+
+func newTestServiceConfig() *testServiceConfig {
+	return &testServiceConfig{
+		MaxConns: 10,
+		Ratio:    0.5,
+		Mode:     "fast",
+		Region:   "eu",
+		Backend:  testBackendConfig{Addresses: []string{"a:80"}, Timeout: time.Second},
+		NotAFlag: 7,
+	}
+}
+
+func TestRegisterStruct_CreatesFlags(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	_, err := flagz.RegisterStruct(set, "svc", newTestServiceConfig())
+	require.NoError(t, err)
+
+	for name, dynamic := range map[string]bool{
+		"svc_max_conns":         true,
+		"svc_ratio":             true,
+		"svc_mode":              true,
+		"svc_token":             true,
+		"svc_region":            false,
+		"svc_enable_http2":      false,
+		"svc_backend_addresses": true,
+		"svc_backend_timeout":   true,
+	} {
+		f := set.Lookup(name)
+		require.NotNil(t, f, "flag %v must be registered", name)
+		assert.Equal(t, dynamic, flagz.IsFlagDynamic(f), "flag %v must be dynamic=%v", name, dynamic)
+	}
+	assert.Nil(t, set.Lookup("svc_not_a_flag"), "untagged fields must be skipped")
+	assert.Nil(t, set.Lookup("svc_also_not_a_flag"), "fields tagged with - must be skipped")
+	assert.Equal(t, "maximum number of connections", set.Lookup("svc_max_conns").Usage)
+	assert.Equal(t, "10", set.Lookup("svc_max_conns").DefValue, "field values must be defaults")
+	assert.True(t, flagz.IsFlagSecret(set.Lookup("svc_token")))
+}
+
+func TestRegisterStruct_GetReflectsUpdates(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	cfg := newTestServiceConfig()
+	s, err := flagz.RegisterStruct(set, "", cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, set.Parse([]string{"--region=us", "--enable_http2", "--max_conns=20"}))
+	require.NoError(t, flagz.ApplyBatch(set, map[string]string{
+		"ratio":             "0.25",
+		"backend_timeout":   "2s",
+		"backend_addresses": "b:80,c:80",
+	}))
+
+	got := s.Get()
+	assert.EqualValues(t, 20, got.MaxConns)
+	assert.EqualValues(t, 0.25, got.Ratio)
+	assert.Equal(t, "us", got.Region)
+	assert.True(t, got.EnableHTTP2)
+	assert.Equal(t, 2*time.Second, got.Backend.Timeout)
+	assert.Equal(t, []string{"b:80", "c:80"}, got.Backend.Addresses)
+	assert.Equal(t, 7, got.NotAFlag, "untagged fields must be copied from the struct")
+	assert.EqualValues(t, 10, cfg.MaxConns, "dynamic fields of the registered struct must not change")
+}
+
+func TestRegisterStruct_Validators(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	s, err := flagz.RegisterStruct(set, "", newTestServiceConfig())
+	require.NoError(t, err)
+
+	assert.Error(t, set.Set("max_conns", "101"), "range validator must reject values out of range")
+	assert.Error(t, set.Set("mode", "medium"), "regex validator must reject values not matching")
+	assert.Error(t, set.Set("backend_timeout", "1m"), "range validator must reject durations out of range")
+	require.NoError(t, set.Set("mode", "slow"))
+	assert.Equal(t, "slow", s.Get().Mode)
+	assert.EqualValues(t, 10, s.Get().MaxConns)
+}
+
+func TestRegisterStruct_Errors(t *testing.T) {
+	for name, register := range map[string]func(set *flag.FlagSet) error{
+		"unknown option": func(set *flag.FlagSet) error {
+			_, err := flagz.RegisterStruct(set, "", &struct {
+				A int64 `flagz:"dynamic,foo"`
+			}{})
+			return err
+		},
+		"unsupported dynamic type": func(set *flag.FlagSet) error {
+			_, err := flagz.RegisterStruct(set, "", &struct {
+				A int `flagz:"dynamic"`
+			}{})
+			return err
+		},
+		"unsupported type": func(set *flag.FlagSet) error {
+			_, err := flagz.RegisterStruct(set, "", &struct {
+				A map[string]string `flagz:""`
+			}{})
+			return err
+		},
+		"validator of static flag": func(set *flag.FlagSet) error {
+			_, err := flagz.RegisterStruct(set, "", &struct {
+				A int64 `flagz:"validate=range(1,2)"`
+			}{})
+			return err
+		},
+		"validator of wrong type": func(set *flag.FlagSet) error {
+			_, err := flagz.RegisterStruct(set, "", &struct {
+				A string `flagz:"dynamic,validate=range(1,2)"`
+			}{})
+			return err
+		},
+		"malformed range": func(set *flag.FlagSet) error {
+			_, err := flagz.RegisterStruct(set, "", &struct {
+				A int64 `flagz:"dynamic,validate=range(1)"`
+			}{})
+			return err
+		},
+		"duplicate name": func(set *flag.FlagSet) error {
+			_, err := flagz.RegisterStruct(set, "", &struct {
+				A int64 `flagz:"dynamic,name=a"`
+				B int64 `flagz:"name=a"`
+			}{})
+			return err
+		},
+		"nil struct": func(set *flag.FlagSet) error {
+			var cfg *struct {
+				A int64 `flagz:"dynamic"`
+			}
+			_, err := flagz.RegisterStruct(set, "", cfg)
+			return err
+		},
+	} {
+		set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+		assert.Error(t, register(set), "case %q must fail", name)
+		assert.False(t, set.HasFlags(), "case %q must not register any flags", name)
+	}
+}
+
+func TestRegisterStruct_GetReturnsCopies(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	s, err := flagz.RegisterStruct(set, "", newTestServiceConfig())
+	require.NoError(t, err)
+	got := s.Get()
+	got.Backend.Addresses[0] = "mutated"
+	assert.Equal(t, []string{"a:80"}, s.Get().Backend.Addresses, "caller mutations must not leak into the flag")
+}
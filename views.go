@@ -0,0 +1,101 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+// SliceView is a read-only view of the value of a slice flag, e.g. `DynStringSliceValue.View`.
+//
+// The value of a flag is shared by all its readers, and it is replaced rather than modified on updates. A view gives
+// access to it without allowing callers to modify it, so it is safe to use concurrently with updates of the flag.
+// A view keeps observing the value it was taken from, even after the flag is updated.
+//
+// Items that are pointers are shared with the flag too, unless the view copies them, e.g. the networks of an
+// `IPNetList`. Shared items must not be modified either.
+type SliceView[T comparable] struct {
+	items []T
+	// clone, if set, copies each item before it is handed out.
+	clone func(T) T
+}
+
+func (v SliceView[T]) item(i int) T {
+	if v.clone != nil {
+		return v.clone(v.items[i])
+	}
+	return v.items[i]
+}
+
+// Len returns the number of items in the slice.
+func (v SliceView[T]) Len() int {
+	return len(v.items)
+}
+
+// At returns the i-th item of the slice. It panics if `i` is out of range, like indexing a slice does.
+func (v SliceView[T]) At(i int) T {
+	return v.item(i)
+}
+
+// Contains returns whether the item is in the slice.
+func (v SliceView[T]) Contains(item T) bool {
+	for _, i := range v.items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Range calls `fn` for each item of the slice in order, until `fn` returns false.
+func (v SliceView[T]) Range(fn func(i int, item T) bool) {
+	for i := range v.items {
+		if !fn(i, v.item(i)) {
+			return
+		}
+	}
+}
+
+// Copy returns a copy of the slice, which the caller is free to modify.
+func (v SliceView[T]) Copy() []T {
+	if v.items == nil {
+		return nil
+	}
+	ret := make([]T, len(v.items))
+	for i := range v.items {
+		ret[i] = v.item(i)
+	}
+	return ret
+}
+
+// SetView is a read-only view of the value of a set flag, e.g. `DynStringSetValue.View`.
+// Like `SliceView`, it is safe to use concurrently with updates of the flag.
+type SetView[T comparable] struct {
+	items map[T]struct{}
+}
+
+// Len returns the number of items in the set.
+func (v SetView[T]) Len() int {
+	return len(v.items)
+}
+
+// Contains returns whether the item is in the set.
+func (v SetView[T]) Contains(item T) bool {
+	_, ok := v.items[item]
+	return ok
+}
+
+// Range calls `fn` for each item of the set in unspecified order, until `fn` returns false.
+func (v SetView[T]) Range(fn func(item T) bool) {
+	for item := range v.items {
+		if !fn(item) {
+			return
+		}
+	}
+}
+
+// Copy returns a copy of the set, which the caller is free to modify.
+func (v SetView[T]) Copy() map[T]struct{} {
+	ret := make(map[T]struct{}, len(v.items))
+	for item := range v.items {
+		ret[item] = struct{}{}
+	}
+	return ret
+}
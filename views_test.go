@@ -0,0 +1,130 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSliceView_Accessors(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynVal := flagz.DynStringSlice(set, "some_stringslice_1", []string{"foo", "bar", "baz"}, "Use it or lose it")
+	view := dynVal.View()
+	assert.Equal(t, 3, view.Len())
+	assert.Equal(t, "bar", view.At(1))
+	assert.True(t, view.Contains("baz"))
+	assert.False(t, view.Contains("car"))
+	visited := []string{}
+	view.Range(func(i int, item string) bool {
+		visited = append(visited, item)
+		return i < 1
+	})
+	assert.Equal(t, []string{"foo", "bar"}, visited, "range must stop when fn returns false")
+
+	require.NoError(t, set.Set("some_stringslice_1", "car"))
+	assert.Equal(t, 3, view.Len(), "views must keep observing the value they were taken from")
+	assert.Equal(t, []string{"car"}, dynVal.View().Copy())
+}
+
+func TestSetView_Accessors(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynVal := flagz.DynStringSet(set, "some_stringset_1", []string{"foo", "bar"}, "Use it or lose it")
+	view := dynVal.View()
+	assert.Equal(t, 2, view.Len())
+	assert.True(t, view.Contains("foo"))
+	assert.False(t, view.Contains("car"))
+	visited := 0
+	view.Range(func(item string) bool {
+		visited++
+		return false
+	})
+	assert.Equal(t, 1, visited, "range must stop when fn returns false")
+	assert.Equal(t, map[string]struct{}{"foo": {}, "bar": {}}, view.Copy())
+}
+
+func TestDynStringSlice_DefaultIsCopied(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	defaults := []string{"foo", "bar"}
+	dynVal := flagz.DynStringSlice(set, "some_stringslice_1", defaults, "Use it or lose it")
+	defaults[0] = "yolo"
+	assert.Equal(t, []string{"foo", "bar"}, dynVal.View().Copy(), "modifying the defaults must not change the flag")
+}
+
+func TestSliceView_CopyMutationsDontLeak(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynVal := flagz.DynStringSlice(set, "some_stringslice_1", []string{"c", "b", "a"}, "Use it or lose it")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				items := dynVal.View().Copy()
+				sort.Strings(items)
+				items = append(items, "z")
+				items[0] = "mutated"
+				view := dynVal.View()
+				for k := 0; k < view.Len(); k++ {
+					assert.NotEqual(t, "mutated", view.At(k), "caller mutations must not leak into the flag")
+				}
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		require.NoError(t, set.Set("some_stringslice_1", "c,b,a"))
+	}
+	wg.Wait()
+	assert.Equal(t, []string{"c", "b", "a"}, dynVal.View().Copy())
+}
+
+func TestSetView_CopyMutationsDontLeak(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynVal := flagz.DynStringSet(set, "some_stringset_1", []string{"a", "b"}, "Use it or lose it")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				items := dynVal.View().Copy()
+				delete(items, "a")
+				items["mutated"] = struct{}{}
+				assert.False(t, dynVal.View().Contains("mutated"), "caller mutations must not leak into the flag")
+				assert.True(t, dynVal.View().Contains("a"), "caller mutations must not leak into the flag")
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		require.NoError(t, set.Set("some_stringset_1", "a,b"))
+	}
+	wg.Wait()
+	assert.Equal(t, 2, dynVal.View().Len())
+}
+
+func TestSliceView_NetworksAreCopied(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynVal := flagz.DynIPNetList(set, "some_ipnetlist_1", nil, "Use it or lose it")
+	require.NoError(t, set.Set("some_ipnetlist_1", "10.0.0.0/8"))
+
+	n := dynVal.View().At(0)
+	n.IP[0] = 11
+	n.Mask[0] = 0
+	dynVal.View().Range(func(_ int, n *net.IPNet) bool {
+		n.IP[1] = 1
+		return true
+	})
+	dynVal.View().Copy()[0].IP[2] = 1
+	assert.Equal(t, "10.0.0.0/8", dynVal.View().At(0).String(), "modifying the networks of a view must not change the flag")
+	assert.Equal(t, "10.0.0.0/8", dynVal.String())
+}
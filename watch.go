@@ -0,0 +1,202 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"sync"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Change describes an update of a dynamic flag's value.
+type Change[T any] struct {
+	OldValue T
+	NewValue T
+}
+
+// FlagChange describes an update of a dynamic flag in a `FlagSet`, with values in their string representation.
+type FlagChange struct {
+	Name     string
+	OldValue string
+	NewValue string
+	// Source is where `NewValue` came from, see `FlagSource`.
+	Source Source
+}
+
+// Watch returns a channel that receives the changes of this flag's value until the `ctx` is cancelled, after which the
+// channel is closed.
+//
+// The first change delivered has both `OldValue` and `NewValue` set to the current value. Slow consumers don't block
+// updates of the flag: if a change is still waiting to be received, it is replaced by a newer one that spans both,
+// i.e. its `OldValue` is the one of the change it replaced. As such, receivers always end up seeing the latest value.
+func (d *DynValue[T]) Watch(ctx context.Context) <-chan Change[T] {
+	w := &latestWins[Change[T]]{ch: make(chan Change[T], 1)}
+	merge := func(newer Change[T], older Change[T]) Change[T] {
+		newer.OldValue = older.OldValue
+		return newer
+	}
+	remove := d.addListener(
+		func(value T, _ Source) { w.push(Change[T]{OldValue: value, NewValue: value}, merge) },
+		func(oldValue T, newValue T, _ Source) {
+			w.push(Change[T]{OldValue: oldValue, NewValue: newValue}, merge)
+		},
+	)
+	go func() {
+		<-ctx.Done()
+		remove()
+		w.close()
+	}()
+	return w.ch
+}
+
+// watchStrings is the type-agnostic form of `Watch` used by `WatchFlagSet`. Values of secret flags are redacted.
+func (d *DynValue[T]) watchStrings(initial func(value string, source Source), fn func(oldValue string, newValue string, source Source)) (remove func()) {
+	return d.addListener(
+		func(value T, source Source) { initial(d.redact(d.codec.Format(value)), source) },
+		func(oldValue T, newValue T, source Source) {
+			fn(d.redact(d.codec.Format(oldValue)), d.redact(d.codec.Format(newValue)), source)
+		},
+	)
+}
+
+type stringWatchable interface {
+	watchStrings(initial func(value string, source Source), fn func(oldValue string, newValue string, source Source)) (remove func())
+}
+
+// WatchFlagSet returns a channel that receives the changes of all dynamic flags of the `flagSet` until the `ctx` is
+// cancelled, after which the channel is closed.
+//
+// The current value of every dynamic flag is delivered first, as a change with equal `OldValue` and `NewValue`.
+// Each change carries the `Source` of its `NewValue`, e.g. to tell updates made by the etcd `Watcher` from local ones.
+// Slow consumers don't block updates: pending changes of the same flag are merged into one spanning all of them, so
+// receivers always end up seeing the latest value of each flag. Only flags defined at the time of the call are watched.
+// Values of secret flags are redacted, see `RedactFlagValue`.
+func WatchFlagSet(ctx context.Context, flagSet *flag.FlagSet) <-chan FlagChange {
+	w := newFlagSetWatch()
+	removers := []func(){}
+	flagSet.VisitAll(func(f *flag.Flag) {
+		watchable, ok := f.Value.(stringWatchable)
+		if !ok || !IsFlagDynamic(f) {
+			return
+		}
+		name := f.Name
+		removers = append(removers, watchable.watchStrings(
+			func(value string, source Source) {
+				w.push(FlagChange{Name: name, OldValue: value, NewValue: value, Source: source})
+			},
+			func(oldValue string, newValue string, source Source) {
+				w.push(FlagChange{Name: name, OldValue: oldValue, NewValue: newValue, Source: source})
+			},
+		))
+	})
+	go func() {
+		w.pump(ctx)
+		for _, remove := range removers {
+			remove()
+		}
+	}()
+	return w.out
+}
+
+// latestWins is a single-slot mailbox whose pending item is merged with newer ones instead of blocking the sender.
+type latestWins[C any] struct {
+	mu     sync.Mutex
+	ch     chan C
+	closed bool
+}
+
+func (w *latestWins[C]) push(item C, merge func(newer C, older C) C) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	select {
+	case w.ch <- item:
+		return
+	default:
+	}
+	// The slot is taken, replace its content. We're the only sender, so the send below can't block.
+	select {
+	case older := <-w.ch:
+		item = merge(item, older)
+	default:
+	}
+	w.ch <- item
+}
+
+func (w *latestWins[C]) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	close(w.ch)
+}
+
+// flagSetWatch buffers at most one pending change per flag, delivering them in the order the flags first changed.
+type flagSetWatch struct {
+	mu      sync.Mutex
+	pending map[string]*FlagChange
+	order   []string
+	signal  chan struct{}
+	out     chan FlagChange
+}
+
+func newFlagSetWatch() *flagSetWatch {
+	return &flagSetWatch{
+		pending: make(map[string]*FlagChange),
+		signal:  make(chan struct{}, 1),
+		out:     make(chan FlagChange),
+	}
+}
+
+func (w *flagSetWatch) push(change FlagChange) {
+	w.mu.Lock()
+	if older, ok := w.pending[change.Name]; ok {
+		older.NewValue, older.Source = change.NewValue, change.Source
+	} else {
+		w.pending[change.Name] = &change
+		w.order = append(w.order, change.Name)
+	}
+	w.mu.Unlock()
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (w *flagSetWatch) pop() (FlagChange, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.order) == 0 {
+		return FlagChange{}, false
+	}
+	name := w.order[0]
+	w.order = w.order[1:]
+	change := w.pending[name]
+	delete(w.pending, name)
+	return *change, true
+}
+
+func (w *flagSetWatch) pump(ctx context.Context) {
+	defer close(w.out)
+	for {
+		for {
+			change, ok := w.pop()
+			if !ok {
+				break
+			}
+			select {
+			case w.out <- change:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-w.signal:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
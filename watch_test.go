@@ -0,0 +1,124 @@
+// Copyright 2015 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receiveChange[C any](t *testing.T, ch <-chan C) C {
+	select {
+	case <-time.After(100 * time.Millisecond):
+		require.FailNow(t, "failed to receive a change")
+	case c, ok := <-ch:
+		require.True(t, ok, "channel must not be closed")
+		return c
+	}
+	panic("unreachable")
+}
+
+func TestWatch_DeliversCurrentValueThenChanges(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynInt64(set, "some_int_1", 13371337, "Use it or lose it")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := dynFlag.Watch(ctx)
+	assert.Equal(t, Change[int64]{13371337, 13371337}, receiveChange(t, ch), "first change must carry the current value")
+	require.NoError(t, set.Set("some_int_1", "1"))
+	assert.Equal(t, Change[int64]{13371337, 1}, receiveChange(t, ch))
+	require.NoError(t, set.Set("some_int_1", "2"))
+	assert.Equal(t, Change[int64]{1, 2}, receiveChange(t, ch))
+}
+
+func TestWatch_SlowConsumerGetsLatestValue(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynInt64(set, "some_int_1", 0, "Use it or lose it")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := dynFlag.Watch(ctx)
+	receiveChange(t, ch)
+	require.NoError(t, set.Set("some_int_1", "1"))
+	require.NoError(t, set.Set("some_int_1", "2"))
+	require.NoError(t, set.Set("some_int_1", "3"))
+	assert.Equal(t, Change[int64]{0, 3}, receiveChange(t, ch), "pending changes must be merged, latest winning")
+	select {
+	case c := <-ch:
+		assert.Fail(t, "no more changes expected", "got %v", c)
+	case <-time.After(5 * time.Millisecond):
+	}
+}
+
+func TestWatch_ClosesChannelOnCancel(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynInt64(set, "some_int_1", 0, "Use it or lose it")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ch := dynFlag.Watch(ctx)
+	receiveChange(t, ch)
+	cancel()
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok, "channel must be closed after cancelling")
+	case <-time.After(100 * time.Millisecond):
+		assert.Fail(t, "channel wasn't closed after cancelling")
+	}
+	require.NoError(t, set.Set("some_int_1", "1"), "updates must work after a watch is cancelled")
+}
+
+func TestWatchFlagSet_DeliversChangesOfDynamicFlags(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynInt64(set, "some_int_1", 1, "Use it or lose it")
+	DynString(set, "some_string_1", "foo", "Use it or lose it")
+	set.String("some_static_string", "static", "Not watched")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := WatchFlagSet(ctx, set)
+	initial := map[string]FlagChange{}
+	for i := 0; i < 2; i++ {
+		c := receiveChange(t, ch)
+		initial[c.Name] = c
+	}
+	assert.Equal(t, map[string]FlagChange{
+		"some_int_1":    {Name: "some_int_1", OldValue: "1", NewValue: "1", Source: SourceDefault},
+		"some_string_1": {Name: "some_string_1", OldValue: "foo", NewValue: "foo", Source: SourceDefault},
+	}, initial, "current values of dynamic flags must be delivered first")
+
+	require.NoError(t, set.Set("some_static_string", "other"))
+	require.NoError(t, set.Set("some_string_1", "bar"))
+	require.NoError(t, set.Set("some_int_1", "2"))
+	require.NoError(t, SetFrom(set, "some_int_1", "3", FileSource("/etc/flagz/some_int_1")))
+	assert.Equal(t, FlagChange{Name: "some_string_1", OldValue: "foo", NewValue: "bar", Source: SourceCommandLine}, receiveChange(t, ch))
+	assert.Equal(t, FlagChange{Name: "some_int_1", OldValue: "1", NewValue: "3", Source: FileSource("/etc/flagz/some_int_1")}, receiveChange(t, ch),
+		"merged changes must carry the source of the latest value")
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestWatchFlagSet_RedactsSecrets(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynSecret(set, "some_secret_1", "s3cr3t", "Use it or lose it")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := WatchFlagSet(ctx, set)
+	assert.Equal(t, FlagChange{Name: "some_secret_1", OldValue: RedactedValue, NewValue: RedactedValue, Source: SourceDefault}, receiveChange(t, ch))
+	require.NoError(t, set.Set("some_secret_1", "hunter2"))
+	assert.Equal(t, FlagChange{Name: "some_secret_1", OldValue: RedactedValue, NewValue: RedactedValue, Source: SourceCommandLine}, receiveChange(t, ch),
+		"changes of secret flags must be redacted")
+
+	cancel()
+	for range ch {
+	}
+}
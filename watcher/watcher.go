@@ -6,6 +6,7 @@
 package watcher
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"strings"
@@ -17,6 +18,11 @@ import (
 	"golang.org/x/net/context"
 )
 
+// OverrideKeySuffix marks etcd keys that hold temporary overrides of flags, e.g. `/flagz/kill_switch@override`.
+// Such keys must be set with a TTL, for which the value overrides the one of the flag's regular key, see
+// `flagz.SetWithTTL`. Once the key expires or is deleted, the flag reverts to the value of its regular key.
+const OverrideKeySuffix = "@override"
+
 var (
 	errNoValue        = fmt.Errorf("no value in Node")
 	errFlagNotDynamic = fmt.Errorf("flag is not dynamic")
@@ -33,6 +39,11 @@ type Watcher struct {
 	watching  bool
 	context   context.Context
 	cancel    context.CancelFunc
+	// etcdFlags holds names of dynamic flags that were set from etcd, so they can be reset if their keys disappear.
+	etcdFlags map[string]struct{}
+	// rollbackIndexes holds the etcd indexes of rollbacks written by the watcher, whose events it skips. Otherwise
+	// rolling back a value the watcher refuses again, e.g. of a frozen flag, would be rolled back in turn, forever.
+	rollbackIndexes map[uint64]struct{}
 }
 
 // Minimum logger interface needed.
@@ -47,12 +58,14 @@ func New(set *flag.FlagSet, keysApi etcd.KeysAPI, etcdPath string, logger logger
 		etcdPath = etcdPath + "/"
 	}
 	u := &Watcher{
-		flagSet:   set,
-		etcdKeys:  keysApi,
-		etcdPath:  etcdPath,
-		logger:    logger,
-		lastIndex: 0,
-		watching:  false,
+		flagSet:         set,
+		etcdKeys:        keysApi,
+		etcdPath:        etcdPath,
+		logger:          logger,
+		lastIndex:       0,
+		watching:        false,
+		etcdFlags:       make(map[string]struct{}),
+		rollbackIndexes: make(map[uint64]struct{}),
 	}
 	u.context, u.cancel = context.WithCancel(context.Background())
 	return u, nil
@@ -95,15 +108,57 @@ func (u *Watcher) readAllFlags(onlyDynamic bool) error {
 		return err
 	}
 	u.lastIndex = resp.Index
+	// Events of earlier rollbacks are either past, or will be skipped by re-reading anyway.
+	u.rollbackIndexes = make(map[uint64]struct{})
 	errorStrings := []string{}
+	seenFlags := make(map[string]struct{})
+	// Dynamic flags are applied as one batch, so that related flags stored in etcd change together.
+	batchValues := make(map[string]string)
+	batchSources := make(map[string]flagz.Source)
+	// Overrides are applied after the regular values, so that they revert to the latest ones.
+	overrideNodes := []*etcd.Node{}
 	for _, node := range resp.Node.Nodes {
 		flagName, err := u.nodeToFlagName(node)
 		if err != nil {
 			u.logger.Printf("flagz: ignoring: %v", err)
 			continue
 		}
-		if err := u.setFlag(flagName, node.Value, onlyDynamic); err != nil && err != errNoValue {
+		if strings.HasSuffix(flagName, OverrideKeySuffix) {
+			overrideNodes = append(overrideNodes, node)
+			continue
+		}
+		seenFlags[flagName] = struct{}{}
+		if flag := u.flagSet.Lookup(flagName); flag != nil && flagz.IsFlagDynamic(flag) && flagz.CheckFlagNotFrozen(flag) == nil && node.Value != "" {
+			batchValues[flagName] = node.Value
+			batchSources[flagName] = etcdSource(node.Key, node.ModifiedIndex)
+			continue
+		}
+		if err := u.setFlag(flagName, node.Value, etcdSource(node.Key, node.ModifiedIndex), onlyDynamic); err != nil && err != errNoValue {
+			errorStrings = append(errorStrings, err.Error())
+		}
+	}
+	if err := flagz.ApplyBatchFrom(u.flagSet, batchValues, batchSources); err != nil {
+		errorStrings = append(errorStrings, err.Error())
+	} else {
+		for flagName := range batchValues {
+			u.etcdFlags[flagName] = struct{}{}
+		}
+	}
+	for _, node := range overrideNodes {
+		flagName, _ := u.nodeToFlagName(node)
+		if err := u.setOverride(strings.TrimSuffix(flagName, OverrideKeySuffix), node, node.ModifiedIndex); err != nil {
+			errorStrings = append(errorStrings, err.Error())
+		}
+	}
+	for flagName := range u.etcdFlags {
+		if _, ok := seenFlags[flagName]; ok {
+			continue
+		}
+		// The key was deleted while we weren't watching.
+		if err := u.resetFlag(flagName); err != nil {
 			errorStrings = append(errorStrings, err.Error())
+		} else {
+			u.logger.Printf("flagz: reset flag=%v to default, its key is gone at etcdindex=%v", flagName, u.lastIndex)
 		}
 	}
 	if len(errorStrings) > 0 {
@@ -113,7 +168,7 @@ func (u *Watcher) readAllFlags(onlyDynamic bool) error {
 	return nil
 }
 
-func (u *Watcher) setFlag(flagName string, value string, onlyDynamic bool) error {
+func (u *Watcher) setFlag(flagName string, value string, source flagz.Source, onlyDynamic bool) error {
 	if value == "" {
 		return errNoValue
 	}
@@ -124,8 +179,37 @@ func (u *Watcher) setFlag(flagName string, value string, onlyDynamic bool) error
 	if onlyDynamic && !flagz.IsFlagDynamic(flag) {
 		return errFlagNotDynamic
 	}
-	// do not call flag.Value.Set, instead go through flagSet.Set to change "changed" state.
-	return u.flagSet.Set(flagName, value)
+	if err := flagz.CheckFlagNotFrozen(flag); err != nil {
+		return err
+	}
+	// do not call flag.Value.Set, instead go through flagz.SetFrom to change "changed" state and record the source.
+	if err := flagz.SetFrom(u.flagSet, flagName, value, source); err != nil {
+		return err
+	}
+	if flagz.IsFlagDynamic(flag) {
+		u.etcdFlags[flagName] = struct{}{}
+	}
+	return nil
+}
+
+// etcdSource returns the `flagz.Source` of values read from the etcd `key` at the given `index`.
+func etcdSource(key string, index uint64) flagz.Source {
+	return flagz.Source(fmt.Sprintf("etcd:%v@%d", key, index))
+}
+
+func (u *Watcher) resetFlag(flagName string) error {
+	flag := u.flagSet.Lookup(flagName)
+	if flag == nil {
+		return fmt.Errorf("flag=%v was not found", flagName)
+	}
+	if !flagz.IsFlagDynamic(flag) {
+		return errFlagNotDynamic
+	}
+	if err := flagz.CheckFlagNotFrozen(flag); err != nil {
+		return err
+	}
+	delete(u.etcdFlags, flagName)
+	return flagz.ResetFlag(u.flagSet, flagName)
 }
 
 func (u *Watcher) watchForUpdates() error {
@@ -165,12 +249,36 @@ func (u *Watcher) watchForUpdates() error {
 			continue
 		}
 		u.lastIndex = resp.Node.ModifiedIndex
+		if _, ok := u.rollbackIndexes[u.lastIndex]; ok {
+			delete(u.rollbackIndexes, u.lastIndex)
+			u.logger.Printf("flagz: skipping own rollback at etcdindex=%v", u.lastIndex)
+			continue
+		}
 		flagName, err := u.nodeToFlagName(resp.Node)
 		if err != nil {
 			u.logger.Printf("flagz: ignoring %v at etcdindex=%v", err, u.lastIndex)
 			continue
 		}
-		err = u.setFlag(flagName, resp.Node.Value /*onlyDynamic*/, true)
+		if strings.HasSuffix(flagName, OverrideKeySuffix) {
+			u.handleOverride(strings.TrimSuffix(flagName, OverrideKeySuffix), resp)
+			continue
+		}
+		if isDeleteAction(resp.Action) {
+			err = u.resetFlag(flagName)
+			if err == errFlagNotDynamic {
+				u.logger.Printf("flagz: ignoring resetting flag=%v at etcdindex=%v, because of: %v", flagName, u.lastIndex, err)
+			} else if errors.Is(err, flagz.ErrFlagFrozen) {
+				u.logger.Printf("flagz: refused resetting flag=%v at etcdindex=%v, because of: %v", flagName, u.lastIndex, err)
+				u.rollbackEtcdValue(flagName, resp)
+			} else if err != nil {
+				u.logger.Printf("flagz: failed resetting flag=%v at etcdindex=%v, because of: %v", flagName, u.lastIndex, err)
+			} else {
+				u.logger.Printf("flagz: reset flag=%v to default after action=%v at etcdindex=%v", flagName, resp.Action, u.lastIndex)
+			}
+			continue
+		}
+		err = u.setFlag(flagName, resp.Node.Value, etcdSource(resp.Node.Key, u.lastIndex),
+			/*onlyDynamic*/ true)
 		if err == errNoValue {
 			u.logger.Printf("flagz: ignoring action=%v on flag=%v at etcdindex=%v", resp.Action, flagName, u.lastIndex)
 			continue
@@ -180,22 +288,95 @@ func (u *Watcher) watchForUpdates() error {
 			u.logger.Printf("flagz: failed updating flag=%v at etcdindex=%v, because of: %v", flagName, u.lastIndex, err)
 			u.rollbackEtcdValue(flagName, resp)
 		} else {
-			u.logger.Printf("flagz: updated flag=%v to value=%v at etcdindex=%v", flagName, resp.Node.Value, u.lastIndex)
+			u.logger.Printf("flagz: updated flag=%v to value=%v at etcdindex=%v", flagName, u.loggedValue(flagName, resp.Node.Value), u.lastIndex)
 		}
 	}
 	u.logger.Printf("flagz: watcher exited")
 	return nil
 }
 
+// loggedValue returns the `value` of the flag as it may be logged, i.e. redacted if the flag is secret.
+func (u *Watcher) loggedValue(flagName string, value string) string {
+	f := u.flagSet.Lookup(flagName)
+	if f == nil {
+		return value
+	}
+	return flagz.RedactFlagValue(f, value)
+}
+
+func (u *Watcher) handleOverride(flagName string, resp *etcd.Response) {
+	if isDeleteAction(resp.Action) {
+		if err := flagz.ClearOverride(u.flagSet, flagName); err != nil {
+			u.logger.Printf("flagz: failed clearing override of flag=%v at etcdindex=%v, because of: %v", flagName, u.lastIndex, err)
+		} else {
+			u.logger.Printf("flagz: cleared override of flag=%v after action=%v at etcdindex=%v", flagName, resp.Action, u.lastIndex)
+		}
+		return
+	}
+	err := u.setOverride(flagName, resp.Node, u.lastIndex)
+	if err == errNoValue {
+		u.logger.Printf("flagz: ignoring action=%v on override of flag=%v at etcdindex=%v", resp.Action, flagName, u.lastIndex)
+	} else if err != nil {
+		u.logger.Printf("flagz: failed overriding flag=%v at etcdindex=%v, because of: %v", flagName, u.lastIndex, err)
+		u.rollbackEtcdValue(flagName, resp)
+	} else {
+		u.logger.Printf("flagz: overrode flag=%v with value=%v for ttl=%v at etcdindex=%v", flagName, u.loggedValue(flagName, resp.Node.Value), nodeTTL(resp.Node), u.lastIndex)
+	}
+}
+
+func (u *Watcher) setOverride(flagName string, node *etcd.Node, index uint64) error {
+	if node.Value == "" {
+		return errNoValue
+	}
+	ttl := nodeTTL(node)
+	if ttl <= 0 {
+		return fmt.Errorf("override key '%v' has no TTL", node.Key)
+	}
+	flag := u.flagSet.Lookup(flagName)
+	if flag == nil {
+		return fmt.Errorf("flag=%v was not found", flagName)
+	}
+	if !flagz.IsFlagDynamic(flag) {
+		return errFlagNotDynamic
+	}
+	if err := flagz.CheckFlagNotFrozen(flag); err != nil {
+		return err
+	}
+	return flagz.SetFromWithTTL(u.flagSet, flagName, node.Value, ttl, etcdSource(node.Key, index))
+}
+
+// nodeTTL returns how long the etcd node has until it expires, or zero if it doesn't expire.
+func nodeTTL(node *etcd.Node) time.Duration {
+	if node.Expiration != nil {
+		return time.Until(*node.Expiration)
+	}
+	return time.Duration(node.TTL) * time.Second
+}
+
+// rollbackEtcdValue restores the etcd key of the refused event `resp` to its previous state. The watcher skips the
+// event of its own rollback.
 func (u *Watcher) rollbackEtcdValue(flagName string, resp *etcd.Response) {
+	var rollback *etcd.Response
 	var err error
-	if resp.PrevNode != nil {
+	isOverride := strings.HasSuffix(resp.Node.Key, OverrideKeySuffix)
+	if isDeleteAction(resp.Action) && resp.PrevNode != nil {
+		// The key was deleted, bring it back unless someone re-created it in the meantime.
+		rollback, err = u.etcdKeys.Set(u.context, resp.Node.Key, resp.PrevNode.Value, &etcd.SetOptions{PrevExist: etcd.PrevNoExist})
+	} else if resp.PrevNode != nil && !isOverride {
 		// It's just a new value that's wrong, roll back to prevNode value atomically.
-		_, err = u.etcdKeys.Set(u.context, resp.Node.Key, resp.PrevNode.Value, &etcd.SetOptions{PrevIndex: u.lastIndex})
+		rollback, err = u.etcdKeys.Set(u.context, resp.Node.Key, resp.PrevNode.Value, &etcd.SetOptions{PrevIndex: u.lastIndex})
+	} else if resp.PrevNode != nil && nodeTTL(resp.PrevNode) > 0 {
+		// Overrides keep the rest of their TTL, without one they would never expire. etcd TTLs are whole seconds, so
+		// it's rounded up to keep it from being zero.
+		ttl := (nodeTTL(resp.PrevNode) + time.Second - 1).Truncate(time.Second)
+		rollback, err = u.etcdKeys.Set(u.context, resp.Node.Key, resp.PrevNode.Value, &etcd.SetOptions{PrevIndex: u.lastIndex, TTL: ttl})
 	} else {
-		_, err = u.etcdKeys.Delete(u.context, resp.Node.Key, &etcd.DeleteOptions{PrevIndex: u.lastIndex})
+		rollback, err = u.etcdKeys.Delete(u.context, resp.Node.Key, &etcd.DeleteOptions{PrevIndex: u.lastIndex})
+	}
+	if err == nil {
+		u.rollbackIndexes[rollback.Node.ModifiedIndex] = struct{}{}
 	}
-	if etcdErr, ok := err.(etcd.Error); ok && etcdErr.Code == etcd.ErrorCodeTestFailed {
+	if etcdErr, ok := err.(etcd.Error); ok && (etcdErr.Code == etcd.ErrorCodeTestFailed || etcdErr.Code == etcd.ErrorCodeNodeExist) {
 		// Someone probably rolled it back in the meantime.
 		u.logger.Printf("flagz: rolled back flag=%v was changed by someone else. All good.", flagName)
 	} else if err != nil {
@@ -205,6 +386,10 @@ func (u *Watcher) rollbackEtcdValue(flagName string, resp *etcd.Response) {
 	}
 }
 
+func isDeleteAction(action string) bool {
+	return action == "delete" || action == "compareAndDelete" || action == "expire"
+}
+
 func (u *Watcher) nodeToFlagName(node *etcd.Node) (string, error) {
 	if node.Dir {
 		return "", fmt.Errorf("key '%v' is a directory entry", node.Key)
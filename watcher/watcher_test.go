@@ -56,6 +56,14 @@ func (s *watcherTestSuite) setFlagzValue(flagzName string, value string) {
 	s.T().Logf("test has set flag=%v to value %v", flagzName, value)
 }
 
+func (s *watcherTestSuite) deleteFlagzValue(flagzName string) {
+	_, err := s.keys.Delete(newCtx(), prefix+flagzName, &etcd.DeleteOptions{})
+	if err != nil {
+		s.T().Fatalf("failed deleting flagz value: %v", err)
+	}
+	s.T().Logf("test has deleted flag=%v", flagzName)
+}
+
 func (s *watcherTestSuite) getFlagzValue(flagzName string) string {
 	resp, err := s.keys.Get(newCtx(), prefix+flagzName, &etcd.GetOptions{})
 	if err != nil {
@@ -65,6 +73,17 @@ func (s *watcherTestSuite) getFlagzValue(flagzName string) string {
 	return resp.Node.Value
 }
 
+// assertFlagzValueIsStable checks that the etcd key of the flag keeps `value` and isn't written to for a while.
+func (s *watcherTestSuite) assertFlagzValueIsStable(flagzName string, value string) {
+	resp, err := s.keys.Get(newCtx(), prefix+flagzName, &etcd.GetOptions{})
+	require.NoError(s.T(), err)
+	time.Sleep(500 * time.Millisecond)
+	after, err := s.keys.Get(newCtx(), prefix+flagzName, &etcd.GetOptions{})
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), value, after.Node.Value, "etcd value of flag=%v should stay", flagzName)
+	assert.Equal(s.T(), resp.Node.ModifiedIndex, after.Node.ModifiedIndex, "etcd key of flag=%v should not be written to", flagzName)
+}
+
 // Tear down the updater
 func (s *watcherTestSuite) TearDownTest() {
 	s.watcher.Stop()
@@ -93,6 +112,8 @@ func (s *watcherTestSuite) Test_SetsInitialValues() {
 	assert.Equal(s.T(), "changed_value", someString.Get(), "string flag should change value")
 	assert.Equal(s.T(), "default_value", anotherString.Get(), "anotherstring should be unchanged")
 	assert.Equal(s.T(), "changed_value2", *normalString, "anotherstring should be unchanged")
+	assert.Contains(s.T(), string(flagz.FlagSource(s.flagSet.Lookup("someint"))), "etcd:", "int flag should be attributed to etcd")
+	assert.Equal(s.T(), flagz.SourceDefault, flagz.FlagSource(s.flagSet.Lookup("anotherstring")), "anotherstring should come from its default")
 
 }
 
@@ -151,6 +172,108 @@ func (s *watcherTestSuite) Test_DynamicUpdateRestoresGoodState() {
 
 }
 
+func (s *watcherTestSuite) Test_DynamicUpdate_DeleteResetsToDefault() {
+	someInt := flagz.DynInt64(s.flagSet, "someint", 1337, "some int usage")
+	s.setFlagzValue("someint", "2015")
+	require.NoError(s.T(), s.watcher.Initialize())
+	require.NoError(s.T(), s.watcher.Start())
+	require.EqualValues(s.T(), 2015, someInt.Get(), "int flag should change value")
+	require.True(s.T(), s.flagSet.Lookup("someint").Changed, "int flag should be marked as changed")
+	require.Contains(s.T(), string(flagz.FlagSource(s.flagSet.Lookup("someint"))), "etcd:", "int flag should be attributed to etcd")
+
+	s.deleteFlagzValue("someint")
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, flagz.SourceDefault,
+		func() interface{} { return flagz.FlagSource(s.flagSet.Lookup("someint")) },
+		"someint should be attributed to its default after its key is deleted")
+	assert.EqualValues(s.T(), 1337, someInt.Get(), "someint value should be reset to default after its key is deleted")
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, false,
+		func() interface{} { return s.flagSet.Lookup("someint").Changed },
+		"int flag should no longer be marked as changed")
+}
+
+func (s *watcherTestSuite) Test_DynamicUpdate_OverrideKeyExpires() {
+	someInt := flagz.DynInt64(s.flagSet, "someint", 1337, "some int usage")
+	s.setFlagzValue("someint", "2015")
+	require.NoError(s.T(), s.watcher.Initialize())
+	require.NoError(s.T(), s.watcher.Start())
+
+	_, err := s.keys.Set(newCtx(), prefix+"someint"+watcher.OverrideKeySuffix, "9999", &etcd.SetOptions{TTL: 1 * time.Second})
+	require.NoError(s.T(), err, "setting an override key must succeed")
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, int64(9999),
+		func() interface{} { return someInt.Get() },
+		"someint value should be overridden")
+	_, ok := flagz.FlagOverride(s.flagSet.Lookup("someint"))
+	assert.True(s.T(), ok, "override should be pending expiry")
+
+	s.setFlagzValue("someint", "2016")
+	time.Sleep(100 * time.Millisecond)
+	assert.EqualValues(s.T(), 9999, someInt.Get(), "regular updates must not replace the override")
+	eventually(s.T(), 3*time.Second,
+		assert.ObjectsAreEqualValues, int64(2016),
+		func() interface{} { return someInt.Get() },
+		"someint value should revert to the latest regular value once the override expires")
+}
+
+func (s *watcherTestSuite) Test_DynamicUpdate_FrozenFlagIsRolledBack() {
+	someInt := flagz.DynInt64(s.flagSet, "someint", 1337, "some int usage")
+	s.setFlagzValue("someint", "2015")
+	require.NoError(s.T(), s.watcher.Initialize())
+	require.NoError(s.T(), flagz.Freeze(s.flagSet, "someint", "release freeze"))
+	require.NoError(s.T(), s.watcher.Start())
+
+	s.setFlagzValue("someint", "2016")
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, "2015",
+		func() interface{} { return s.getFlagzValue("someint") },
+		"etcd value of frozen someint should be rolled back")
+	s.assertFlagzValueIsStable("someint", "2015")
+	assert.EqualValues(s.T(), 2015, someInt.Get(), "frozen someint should not change")
+}
+
+func (s *watcherTestSuite) Test_DynamicUpdate_FrozenFlagDeleteIsRolledBack() {
+	someInt := flagz.DynInt64(s.flagSet, "someint", 1337, "some int usage")
+	s.setFlagzValue("someint", "2015")
+	require.NoError(s.T(), s.watcher.Initialize())
+	require.NoError(s.T(), flagz.Freeze(s.flagSet, "someint", "release freeze"))
+	require.NoError(s.T(), s.watcher.Start())
+
+	s.deleteFlagzValue("someint")
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, "2015",
+		func() interface{} { return s.getFlagzValue("someint") },
+		"deleted etcd key of frozen someint should be restored")
+	s.assertFlagzValueIsStable("someint", "2015")
+	assert.EqualValues(s.T(), 2015, someInt.Get(), "frozen someint should not change")
+}
+
+func (s *watcherTestSuite) Test_DynamicUpdate_RejectedOverrideKeepsItsTTL() {
+	someInt := flagz.DynInt64(s.flagSet, "someint", 1337, "some int usage")
+	s.setFlagzValue("someint", "2015")
+	require.NoError(s.T(), s.watcher.Initialize())
+	require.NoError(s.T(), s.watcher.Start())
+
+	_, err := s.keys.Set(newCtx(), prefix+"someint"+watcher.OverrideKeySuffix, "9999", &etcd.SetOptions{TTL: 5 * time.Second})
+	require.NoError(s.T(), err, "setting an override key must succeed")
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, int64(9999),
+		func() interface{} { return someInt.Get() },
+		"someint value should be overridden")
+
+	s.setFlagzValue("someint"+watcher.OverrideKeySuffix, "7777")
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, "9999",
+		func() interface{} { return s.getFlagzValue("someint" + watcher.OverrideKeySuffix) },
+		"override without a TTL should be rolled back")
+	s.assertFlagzValueIsStable("someint"+watcher.OverrideKeySuffix, "9999")
+	resp, err := s.keys.Get(newCtx(), prefix+"someint"+watcher.OverrideKeySuffix, &etcd.GetOptions{})
+	require.NoError(s.T(), err)
+	assert.True(s.T(), resp.Node.TTL > 0, "rolled back override should keep its TTL")
+	assert.EqualValues(s.T(), 9999, someInt.Get())
+}
+
 func (s *watcherTestSuite) Test_DynamicUpdate_WroteBadSubdirectory() {
 	someInt := flagz.DynInt64(s.flagSet, "someint", 1337, "some int usage")
 	require.NoError(s.T(), s.watcher.Initialize())